@@ -0,0 +1,201 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+const (
+	// CaseUpper converts the value to UPPER CASE
+	CaseUpper = "upper"
+	// CaseLower converts the value to lower case
+	CaseLower = "lower"
+	// CaseTitle capitalizes every word except for the small words in TitleSmallWords: The Lord of the Rings
+	CaseTitle = "title"
+	// CaseSentence capitalizes the first letter of each sentence and lowers the rest: The lord of the rings
+	CaseSentence = "sentence"
+	// CaseCamel joins the words of the value in camelCase
+	CaseCamel = "camel"
+	// CasePascal joins the words of the value in PascalCase
+	CasePascal = "pascal"
+	// CaseSnake joins the words of the value in snake_case
+	CaseSnake = "snake"
+	// CaseKebab joins the words of the value in kebab-case
+	CaseKebab = "kebab"
+	// CaseSwap inverts the case of each letter
+	CaseSwap = "swap"
+)
+
+// caseModes lists the supported case conversions
+var caseModes = []string{CaseUpper, CaseLower, CaseTitle, CaseSentence, CaseCamel, CasePascal, CaseSnake, CaseKebab, CaseSwap}
+
+// TitleSmallWords lists the words the title case conversion leaves in lower case, unless they are the
+// first or the last word of the value
+var TitleSmallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true, "by": true, "for": true,
+	"from": true, "in": true, "into": true, "nor": true, "of": true, "on": true, "or": true, "per": true,
+	"the": true, "to": true, "vs": true, "via": true, "with": true,
+}
+
+// CaseFormatter changes the case of a value. The case formatter is called with the ^ character followed
+// by the name of the conversion and, optionally, a language tag after a colon for locale aware
+// conversions: $title[^title], $title[^upper:tr].
+type CaseFormatter struct {
+	Mode   string
+	Locale string
+	tag    language.Tag
+}
+
+// NewCaseFormatter creates a new case formatter for the given conversion and language tag. An empty
+// locale uses conversions that are not specific to a language.
+func NewCaseFormatter(mode, locale string) (CaseFormatter, error) {
+	tag := language.Und
+	if locale != "" {
+		parsed, err := language.Parse(locale)
+		if err != nil {
+			return CaseFormatter{}, err
+		}
+		tag = parsed
+	}
+	return CaseFormatter{
+		Mode:   mode,
+		Locale: locale,
+		tag:    tag,
+	}, nil
+}
+
+// Format converts the case of the given value
+func (f *CaseFormatter) Format(value string, rstate renamerState) (string, error) {
+	switch f.Mode {
+	case CaseUpper:
+		return cases.Upper(f.tag).String(value), nil
+	case CaseLower:
+		return cases.Lower(f.tag).String(value), nil
+	case CaseTitle:
+		return f.title(value), nil
+	case CaseSentence:
+		return f.sentence(value), nil
+	case CaseSwap:
+		return swapCase(value), nil
+	}
+
+	words := splitWords(value)
+	lower := cases.Lower(f.tag)
+	title := cases.Title(f.tag)
+	for idx, w := range words {
+		if f.Mode == CasePascal || (f.Mode == CaseCamel && idx > 0) {
+			words[idx] = title.String(w)
+		} else {
+			words[idx] = lower.String(w)
+		}
+	}
+	switch f.Mode {
+	case CaseSnake:
+		return strings.Join(words, "_"), nil
+	case CaseKebab:
+		return strings.Join(words, "-"), nil
+	}
+	return strings.Join(words, ""), nil
+}
+
+// title capitalizes the words of the value separated by spaces, small words other than the first and
+// the last are lowered
+func (f *CaseFormatter) title(value string) string {
+	lower := cases.Lower(f.tag)
+	title := cases.Title(f.tag)
+	words := strings.Split(value, " ")
+	last := len(words) - 1
+	for last > 0 && words[last] == "" {
+		last--
+	}
+	for idx, w := range words {
+		if idx > 0 && idx < last && TitleSmallWords[lower.String(w)] {
+			words[idx] = lower.String(w)
+			continue
+		}
+		words[idx] = title.String(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// sentence lowers the value and capitalizes the first letter of each sentence
+func (f *CaseFormatter) sentence(value string) string {
+	upper := cases.Upper(f.tag)
+	runes := []rune(cases.Lower(f.tag).String(value))
+	out := ""
+	capitalize := true
+	for _, chr := range runes {
+		if capitalize && unicode.IsLetter(chr) {
+			out += upper.String(string(chr))
+			capitalize = false
+			continue
+		}
+		if chr == '.' || chr == '!' || chr == '?' {
+			capitalize = true
+		}
+		out += string(chr)
+	}
+	return out
+}
+
+// String returns the case formatter declaration as it appears in the output definition
+func (f *CaseFormatter) String() string {
+	if f.Locale != "" {
+		return "^" + f.Mode + ":" + f.Locale
+	}
+	return "^" + f.Mode
+}
+
+// swapCase inverts the case of each letter of the value
+func swapCase(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		if unicode.IsLower(r) {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, value)
+}
+
+// splitWords splits a value in words at characters other than letters and digits and at case changes:
+// "my.videoFile HTMLParser" returns my, video, File, HTML, Parser
+func splitWords(value string) []string {
+	words := make([]string, 0)
+	runes := []rune(value)
+	start := -1
+	for idx, chr := range runes {
+		if !unicode.IsLetter(chr) && !unicode.IsDigit(chr) {
+			if start >= 0 {
+				words = append(words, string(runes[start:idx]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = idx
+			continue
+		}
+		prev := runes[idx-1]
+		// videoFile, or the last capital of an acronym followed by a lower case letter: HTMLParser
+		if unicode.IsUpper(chr) && (unicode.IsLower(prev) || (unicode.IsUpper(prev) && idx+1 < len(runes) && unicode.IsLower(runes[idx+1]))) {
+			words = append(words, string(runes[start:idx]))
+			start = idx
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func suggestCaseMode(mode string) string {
+	modes := append([]string{}, caseModes...)
+	sort.Strings(modes)
+	return suggest(mode, modes)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func formatCase(t *testing.T, mode, locale, value string) string {
+	formatter, err := NewCaseFormatter(mode, locale)
+	assert.Nil(t, err)
+	out, err := formatter.Format(value, renamerState{})
+	assert.Nil(t, err)
+	return out
+}
+
+func TestCaseFormatter(t *testing.T) {
+	assert.Equal(t, "THE LORD", formatCase(t, CaseUpper, "", "the Lord"))
+	assert.Equal(t, "the lord", formatCase(t, CaseLower, "", "THE Lord"))
+	assert.Equal(t, "The Lord of the Rings", formatCase(t, CaseTitle, "", "the LORD OF THE rings"))
+	assert.Equal(t, "Of Mice and Men", formatCase(t, CaseTitle, "", "of mice and men"))
+	assert.Equal(t, "The end. A new start", formatCase(t, CaseSentence, "", "THE END. a NEW start"))
+	assert.Equal(t, "myVideoFile2", formatCase(t, CaseCamel, "", "My video.file 2"))
+	assert.Equal(t, "HtmlParserTest", formatCase(t, CasePascal, "", "HTMLParser test"))
+	assert.Equal(t, "my_video_file", formatCase(t, CaseSnake, "", "myVideo-File"))
+	assert.Equal(t, "my-video-file", formatCase(t, CaseKebab, "", "My Video  File"))
+	assert.Equal(t, "hELLO wORLD", formatCase(t, CaseSwap, "", "Hello World"))
+}
+
+func TestCaseFormatterLocale(t *testing.T) {
+	assert.Equal(t, "İSTANBUL", formatCase(t, CaseUpper, "tr", "istanbul"))
+	assert.Equal(t, "ISTANBUL", formatCase(t, CaseUpper, "", "istanbul"))
+}
+
+func TestParseCaseFormatter(t *testing.T) {
+	tokens, err := ParseOutput("$title[^title,>:3] $show[^upper:tr]")
+	assert.Nil(t, err)
+	assert.Equal(t, "^title", tokens[0].Formatter[0].(*CaseFormatter).String())
+	assert.Equal(t, "^upper:tr", tokens[2].Formatter[0].(*CaseFormatter).String())
+
+	_, err = ParseOutput("$title[^titel]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+	assert.Equal(t, CaseTitle, err.(*ParseError).Suggestion)
+
+	_, err = ParseOutput("$title[^upper:]")
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseOutput("$title[^upper:123456789]")
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -120,6 +120,58 @@ func TestUndo(t *testing.T) {
 	assert.Equal(t, "[UnionVideos] Wedding - 2 - Chapel.mkv", files[1])
 }
 
+func TestReseqUndo(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+	for _, name := range []string{"img_0003.jpg", "img_0007.jpg", "img_0012.jpg"} {
+		assert.Nil(t, testCtx.CreateFile(name))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(testCtx.filesDir, name), []byte(name), 0644))
+	}
+
+	app := getApp()
+	args := append([]string{"raf", "reseq"}, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.Nil(t, err)
+	files, err := testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"img_0001.jpg", "img_0002.jpg", "img_0003.jpg"}, files)
+
+	// the original img_0003.jpg is now img_0001.jpg and the name is reused by img_0012.jpg
+	err = app.Run([]string{"raf", "undo", testCtx.filesDir})
+	assert.Nil(t, err)
+	files, err = testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"img_0003.jpg", "img_0007.jpg", "img_0012.jpg"}, files)
+	for _, name := range files {
+		content, err := ioutil.ReadFile(filepath.Join(testCtx.filesDir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, name, string(content))
+	}
+}
+
+func TestReseqMacros(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+	for _, name := range []string{"take2_v9.wav", "take5_v9.wav"} {
+		assert.Nil(t, testCtx.CreateFile(name))
+	}
+	file, err := ioutil.TempFile(os.TempDir(), "raf_macros")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("take = take(\\d+)\n")
+	assert.Nil(t, err)
+	file.Close()
+	defer delete(Macros, "take")
+
+	app := getApp()
+	args := append([]string{"raf", "reseq", "--macros", file.Name(), "-p", "num={take}"}, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.Nil(t, err)
+	files, err := testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"take1_v9.wav", "take2_v9.wav"}, files)
+}
+
 func TestCollisions(t *testing.T) {
 	writeTestRLog = true
 	testCtx, err := createIntegTestContext(t)
@@ -214,6 +266,84 @@ func TestMultipleFormatters(t *testing.T) {
 	assert.Equal(t, "test - 1 - my home .avi", files[0])
 }
 
+func TestNamedCaptureGroups(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+
+	err = testCtx.CreateFiles("[UnionVideos] Wedding - $cnt - $title.mkv", "Home", "Chapel")
+	assert.Nil(t, err)
+
+	app := getApp()
+	args := []string{"raf", "--prop", "re=\\[(?P<studio>\\w+)\\] (?P<event>\\w+) - (\\d+) - (\\w+)", "--output", "$event - $re.3 - $re ($studio)$ext"}
+	args = append(args, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.Nil(t, err)
+
+	files, err := testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, "Wedding - 1 - Home (UnionVideos).mkv", files[0])
+	assert.Equal(t, "Wedding - 2 - Chapel (UnionVideos).mkv", files[1])
+}
+
+func TestMatchPattern(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+
+	err = testCtx.CreateFiles("[UnionVideos] Wedding - $cnt - $title.mkv", "Home", "Chapel")
+	assert.Nil(t, err)
+	err = testCtx.CreateFile("notes.txt")
+	assert.Nil(t, err)
+
+	app := getApp()
+	args := []string{"raf", "--match", "[{studio}] {event:word} - {num:int} - {title}{ext}", "--output", "$event $num[%02] - $title$ext"}
+	args = append(args, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.Nil(t, err)
+
+	files, err := testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	assert.Equal(t, "Wedding 01 - Home.mkv", files[0])
+	assert.Equal(t, "Wedding 02 - Chapel.mkv", files[1])
+	assert.Equal(t, "notes.txt", files[2])
+}
+
+func TestVarUnknownVariable(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+
+	err = testCtx.CreateFiles("[UnionVideos] Wedding - $cnt - $title.mkv", "Home")
+	assert.Nil(t, err)
+
+	app := getApp()
+	args := []string{"raf", "--prop", "title=\\d\\ \\-\\ ([A-Za-z0-9]+)\\.mkv", "--var", "base=$titel $cnt", "--output", "$base$ext", "-d"}
+	args = append(args, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "base=$titel $cnt", err.(*ParseError).Input)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+	assert.Equal(t, "$title", err.(*ParseError).Suggestion)
+}
+
+func TestGroupReferenceFollowedByDigits(t *testing.T) {
+	testCtx, err := createIntegTestContext(t)
+	assert.Nil(t, err)
+
+	err = testCtx.CreateFile("Show E02.mkv")
+	assert.Nil(t, err)
+
+	app := getApp()
+	args := []string{"raf", "-p", "ep=E(\\d+)", "-o", "Show.E$ep.1080p.mkv"}
+	args = append(args, testCtx.Files(true)...)
+	err = app.Run(args)
+	assert.Nil(t, err)
+
+	files, err := testCtx.ListFilesInWorkingDir(false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Show.E02.1080p.mkv"}, files)
+}
+
 func TestPartialRenameLog(t *testing.T) {
 	testCtx, err := createIntegTestContext(t)
 	assert.Nil(t, err)
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// counterVarName is the name of the intrinsic counter variable, the only variable that accepts options
+// in the output definition
+const counterVarName = "$cnt"
+
+// counterGroupDir groups the counter by the directory containing the files
+const counterGroupDir = "dir"
+
+const (
+	// CounterModeContinue starts the counter after the highest value used by the files that already
+	// exist in the destination and match the output
+	CounterModeContinue = "continue"
+	// CounterModeFill assigns the lowest values that are not used by the files that already exist in
+	// the destination and match the output, filling the gaps in the numbering
+	CounterModeFill = "fill"
+)
+
+// CounterOptions configures how the $cnt variable counts the files. The options are declared for all
+// counters with the --cnt flag, and for a single token in curly braces after its name:
+// $cnt{start=101,by=$season}. Options declared on the token replace the ones from the flag.
+type CounterOptions struct {
+	// Start is the value of the counter for the first file. When it is not set, the counter starts
+	// from 1, or counts down to 1 if the step is negative
+	Start    int
+	HasStart bool
+	// Step is added to the counter for each file, 0 means 1
+	Step int
+	// By resets the counter for each directory (dir) or for each distinct value of a variable ($season)
+	By string
+	// Width zero-pads the counter to the given number of digits. With AutoWidth, the width is the number
+	// of digits of the largest value of the counter
+	Width     int
+	AutoWidth bool
+	// Mode is CounterModeContinue or CounterModeFill to take into account the files that already exist
+	// in the destination, empty to ignore them
+	Mode string
+}
+
+// ParseCounterOptions applies the options declared in an option list to the base counter options.
+// Errors report the position of the option in the input string.
+func ParseCounterOptions(input string, base CounterOptions, options []option) (CounterOptions, error) {
+	out := base
+	for _, o := range options {
+		switch o.Key {
+		case "start":
+			start, err := strconv.Atoi(o.Value)
+			if err != nil {
+				return CounterOptions{}, newParseError(input, o.Pos, "Invalid counter start \"%s\", the start must be a number", o.Value)
+			}
+			out.Start = start
+			out.HasStart = true
+		case "step":
+			step, err := strconv.Atoi(o.Value)
+			if err != nil || step == 0 {
+				return CounterOptions{}, newParseError(input, o.Pos, "Invalid counter step \"%s\", the step must be a number other than 0", o.Value)
+			}
+			out.Step = step
+		case "by":
+			if o.Value != counterGroupDir && (len(o.Value) < 2 || o.Value[0] != '$') {
+				return CounterOptions{}, newParseError(input, o.Pos, "Invalid counter group \"%s\", counters can be grouped by dir or by a variable such as $season", o.Value)
+			}
+			out.By = o.Value
+		case "width":
+			if o.Value == "auto" {
+				out.AutoWidth = true
+				out.Width = 0
+				continue
+			}
+			width, err := strconv.Atoi(o.Value)
+			if err != nil || width < 0 {
+				return CounterOptions{}, newParseError(input, o.Pos, "Invalid counter width \"%s\", the width must be auto or a positive number", o.Value)
+			}
+			out.Width = width
+			out.AutoWidth = false
+		case "mode":
+			if o.Value != CounterModeContinue && o.Value != CounterModeFill {
+				return CounterOptions{}, newParseError(input, o.Pos, "Invalid counter mode \"%s\", supported modes are continue and fill", o.Value)
+			}
+			out.Mode = o.Value
+		default:
+			err := newParseError(input, o.Pos, "Unknown counter option %s", o.Key)
+			err.Suggestion = suggest(o.Key, []string{"by", "mode", "start", "step", "width"})
+			return CounterOptions{}, err
+		}
+	}
+	return out, nil
+}
+
+// ParseCounterFlag parses the value of the --cnt flag, a list of counter options without the curly
+// braces: "start=101,step=2"
+func ParseCounterFlag(v string) (CounterOptions, error) {
+	if v == "" {
+		return CounterOptions{}, nil
+	}
+	options, _, err := parseOptionList("{"+v+"}", 0)
+	if err != nil {
+		return CounterOptions{}, shiftParseError(err, v, -1)
+	}
+	counter, err := ParseCounterOptions("{"+v+"}", CounterOptions{}, options)
+	if err != nil {
+		return CounterOptions{}, shiftParseError(err, v, -1)
+	}
+	return counter, nil
+}
+
+// counterKey returns the name of the variable that stores the value of a counter token. Counters
+// without options use $cnt, counters with options use the name followed by the options so that
+// tokens with different options have different values.
+func counterKey(t Token) string {
+	if len(t.Options) == 0 {
+		return t.Value
+	}
+	opts := make([]string, len(t.Options))
+	for idx, o := range t.Options {
+		opts[idx] = o.Key + "=" + o.Value
+	}
+	return t.Value + "{" + strings.Join(opts, ",") + "}"
+}
+
+// counterTokens returns the counter tokens of the output and of the vars templates
+func counterTokens(tokens TokenStream, vars []Var) []Token {
+	counters := make([]Token, 0)
+	streams := []TokenStream{tokens}
+	for _, v := range vars {
+		streams = append(streams, v.Tokens)
+	}
+	for _, stream := range streams {
+		for _, t := range propertyTokens(stream) {
+			if t.Value == counterVarName {
+				counters = append(counters, t)
+			}
+		}
+	}
+	return counters
+}
+
+// computeCounters stores the value of each counter token of the output and of the vars in the variable
+// values of the jobs. Counters grouped by a variable must be computed after the props and intrinsics
+// are extracted.
+func computeCounters(jobs []renameJob, tokens TokenStream, vars []Var, opts Opts) error {
+	for _, t := range counterTokens(tokens, vars) {
+		key := counterKey(t)
+		counter, err := ParseCounterOptions("", opts.Counter, t.Options)
+		if err != nil {
+			return err
+		}
+		values, err := counterValues(jobs, counter, tokens, key)
+		if err != nil {
+			return err
+		}
+
+		width := counter.Width
+		if counter.AutoWidth {
+			for _, v := range values {
+				if digits := len(strconv.Itoa(abs(v))); digits > width {
+					width = digits
+				}
+			}
+		}
+		for idx, job := range jobs {
+			job.varValues[key] = fmt.Sprintf("%0*d", width, values[idx])
+		}
+	}
+	return nil
+}
+
+// counterValues returns the value of the counter for each job. The output tokens and the key of the
+// counter are used to find the values used by existing files when the counter has a mode.
+func counterValues(jobs []renameJob, counter CounterOptions, tokens TokenStream, key string) ([]int, error) {
+	step := counter.Step
+	if step == 0 {
+		step = 1
+	}
+	if counter.Mode != "" && step < 0 {
+		return nil, fmt.Errorf("The counter mode %s cannot be used with a negative step", counter.Mode)
+	}
+
+	groups := make(map[string][]int)
+	order := make([]string, 0)
+	for idx, job := range jobs {
+		group := ""
+		switch {
+		case counter.By == counterGroupDir:
+			group = filepath.Dir(job.state.path)
+		case counter.By != "":
+			value, ok := job.varValues[counter.By]
+			if !ok {
+				return nil, fmt.Errorf("Cannot group the counter by %s, counters can only be grouped by properties and intrinsics", counter.By)
+			}
+			group = value
+		}
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], idx)
+	}
+
+	values := make([]int, len(jobs))
+	for _, group := range order {
+		members := groups[group]
+		start := counter.Start
+		if !counter.HasStart {
+			start = 1
+			if step < 0 {
+				// count down to 1
+				start = 1 - step*(len(members)-1)
+			}
+		}
+		if counter.Mode == "" {
+			for pos, idx := range members {
+				values[idx] = start + pos*step
+			}
+			continue
+		}
+
+		used, err := existingCounterValues(jobs, members, counter, group, tokens, key)
+		if err != nil {
+			return nil, err
+		}
+		if counter.Mode == CounterModeContinue {
+			for v := range used {
+				if v+step > start {
+					start = v + step
+				}
+			}
+		}
+		value := start
+		for _, idx := range members {
+			for used[value] {
+				value += step
+			}
+			values[idx] = value
+			value += step
+		}
+	}
+	return values, nil
+}
+
+// existingCounterValues lists the files in the directories of the given jobs and returns the values
+// of the counter used by the files whose name matches the output. The files being renamed are ignored.
+func existingCounterValues(jobs []renameJob, members []int, counter CounterOptions, group string, tokens TokenStream, key string) (map[int]bool, error) {
+	expr, found := counterPattern(tokens, counter, group, key)
+	if !found {
+		return nil, fmt.Errorf("The counter %s must be used in the output to continue the numbering of existing files", key)
+	}
+	regex, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, err
+	}
+
+	renamed := make(map[string]bool)
+	for _, job := range jobs {
+		renamed[job.state.path] = true
+	}
+	used := make(map[int]bool)
+	scanned := make(map[string]bool)
+	for _, idx := range members {
+		dir := filepath.Dir(jobs[idx].state.path)
+		if scanned[dir] {
+			continue
+		}
+		scanned[dir] = true
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if renamed[filepath.Join(dir, f.Name())] {
+				continue
+			}
+			m := regex.FindStringSubmatch(f.Name())
+			if m == nil {
+				continue
+			}
+			// the counter is captured once for each place it appears in, the first one that
+			// matched holds its value
+			for _, capture := range m[1:] {
+				if v, err := strconv.Atoi(capture); err == nil {
+					used[v] = true
+					break
+				}
+			}
+		}
+	}
+	return used, nil
+}
+
+// counterPattern returns a regular expression that matches the names produced by the tokens and
+// captures the value of the counter with the given key. Groups match any of their alternatives, and
+// their fallback or an empty value. Tokens with formatters change the value they render, so they
+// match any text.
+func counterPattern(tokens TokenStream, counter CounterOptions, group string, key string) (string, bool) {
+	expr := ""
+	found := false
+	for _, t := range tokens {
+		switch {
+		case t.Type == TokenTypeLiteral:
+			expr += regexp.QuoteMeta(t.Value)
+		case t.Type == TokenTypeGroup && len(t.Formatter) == 0:
+			// a group without fallback renders nothing when none of its alternatives has a value
+			streams := append([]TokenStream{}, t.Alternatives...)
+			streams = append(streams, t.Fallback)
+			alts := make([]string, len(streams))
+			for idx, alt := range streams {
+				altExpr, altFound := counterPattern(alt, counter, group, key)
+				alts[idx] = altExpr
+				found = found || altFound
+			}
+			expr += "(?:" + strings.Join(alts, "|") + ")"
+		case t.Type == TokenTypeProperty && counterKey(t) == key:
+			expr += "(\\d+)"
+			found = true
+		case t.Value == counterVarName:
+			expr += "-?\\d+"
+		case t.Value == counter.By && len(t.Formatter) == 0:
+			// the existing files must belong to the same group
+			expr += regexp.QuoteMeta(group)
+		default:
+			expr += ".*?"
+		}
+	}
+	return expr, found
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
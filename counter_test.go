@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func counterJobs(values ...string) []renameJob {
+	jobs := make([]renameJob, len(values))
+	for idx, v := range values {
+		jobs[idx] = renameJob{
+			state:     renamerState{idx: idx, path: filepath.Join("/videos", v, "file.mkv")},
+			varValues: VarValues{"$season": v},
+		}
+	}
+	return jobs
+}
+
+func TestParseCounterOptions(t *testing.T) {
+	tokens, err := ParseOutput("$cnt{start=101,step=2,width=auto}[%x5] - $cnt")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tokens))
+	assert.Equal(t, 3, len(tokens[0].Options))
+	assert.Equal(t, 1, len(tokens[0].Formatter))
+	assert.Equal(t, "$cnt{start=101,step=2,width=auto}", counterKey(tokens[0]))
+	assert.Equal(t, "$cnt", counterKey(tokens[2]))
+
+	_, err = ParseOutput("$cnt{start=a}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$cnt{stat=1}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "start", err.(*ParseError).Suggestion)
+
+	_, err = ParseOutput("$cnt{step=0}")
+	assert.IsType(t, &ParseError{}, err)
+
+	// only the counter accepts options
+	tokens, err = ParseOutput("$title{x}")
+	assert.Nil(t, err)
+	assert.Equal(t, "{x}", tokens[1].Value)
+}
+
+func TestParseCounterFlag(t *testing.T) {
+	counter, err := ParseCounterFlag("start=5,by=dir")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, counter.Start)
+	assert.True(t, counter.HasStart)
+	assert.Equal(t, counterGroupDir, counter.By)
+
+	_, err = ParseCounterFlag("start=1,width=x")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+}
+
+func TestComputeCounters(t *testing.T) {
+	tokens, err := ParseOutput("$cnt{start=101,by=$season} $cnt{step=-1,width=auto} $cnt{by=dir,width=3} $cnt")
+	assert.Nil(t, err)
+	jobs := counterJobs("1", "1", "2", "1")
+	err = computeCounters(jobs, tokens, nil, Opts{Counter: CounterOptions{Start: 10, HasStart: true}})
+	assert.Nil(t, err)
+
+	names := make([]string, len(jobs))
+	for idx, job := range jobs {
+		names[idx], _, err = GenerateName(job.varValues, tokens, job.state, Opts{})
+		assert.Nil(t, err)
+	}
+	// the token options replace the flag options, the other options are inherited from the flag
+	assert.Equal(t, []string{"101 10 010 10", "102 09 011 11", "101 08 010 12", "103 07 012 13"}, names)
+}
+
+func TestCounterCountsDown(t *testing.T) {
+	tokens, err := ParseOutput("$cnt{step=-1}/$total")
+	assert.Nil(t, err)
+	jobs := counterJobs("1", "1", "1")
+	for idx := range jobs {
+		jobs[idx].state.total = len(jobs)
+		jobs[idx].varValues["$total"] = ReservedVarNames["$total"](jobs[idx].state)
+	}
+	assert.Nil(t, computeCounters(jobs, tokens, nil, Opts{}))
+	name, _, err := GenerateName(jobs[0].varValues, tokens, jobs[0].state, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "3/3", name)
+}
+
+func TestComputeCountersUnknownGroup(t *testing.T) {
+	tokens, err := ParseOutput("$cnt{by=$episode}")
+	assert.Nil(t, err)
+	err = computeCounters(counterJobs("1"), tokens, nil, Opts{})
+	assert.NotNil(t, err)
+}
+
+func TestCounterModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-counter")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"Show E01.mkv", "Show E02.mkv", "Show E04.mkv", "Other E09.mkv", "new1.mkv", "new2.mkv"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644))
+	}
+	files := []string{filepath.Join(dir, "new1.mkv"), filepath.Join(dir, "new2.mkv")}
+
+	tokens, err := ParseOutput("Show E$cnt{width=2}$ext")
+	assert.Nil(t, err)
+	jobs, err := prepareRename(nil, nil, tokens, files, Opts{Counter: CounterOptions{Mode: CounterModeContinue}})
+	assert.Nil(t, err)
+	assert.Equal(t, "05", jobs[0].varValues["$cnt{width=2}"])
+	assert.Equal(t, "06", jobs[1].varValues["$cnt{width=2}"])
+
+	tokens, err = ParseOutput("Show E$cnt{mode=fill,width=2}$ext")
+	assert.Nil(t, err)
+	jobs, err = prepareRename(nil, nil, tokens, files, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "03", jobs[0].varValues["$cnt{mode=fill,width=2}"])
+	assert.Equal(t, "05", jobs[1].varValues["$cnt{mode=fill,width=2}"])
+
+	// counters in groups match the alternatives of the group
+	tokens, err = ParseOutput("Show${ E$cnt{mode=continue,width=2}}$ext")
+	assert.Nil(t, err)
+	jobs, err = prepareRename(nil, nil, tokens, files, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "05", jobs[0].varValues["$cnt{mode=continue,width=2}"])
+	assert.Equal(t, "06", jobs[1].varValues["$cnt{mode=continue,width=2}"])
+
+	// the counter must be in the output
+	vars := []Var{{Name: "num", Tokens: tokens}}
+	out, err := ParseOutput("$num")
+	assert.Nil(t, err)
+	_, err = prepareRename(nil, vars, out, files, Opts{})
+	assert.NotNil(t, err)
+
+	_, err = ParseOutput("$cnt{mode=append}")
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// strftimeDirectives maps the strftime directives supported by the date formatter to the equivalent
+// Go layout
+var strftimeDirectives = map[rune]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'Z': "MST",
+	'z': "-0700",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'D': "01/02/06",
+	'R': "15:04",
+}
+
+// dateAutoLayouts lists the layouts the date formatter tries, in order, when it is not given an
+// input layout
+var dateAutoLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006.01.02",
+	"2006_01_02",
+	"2006/01/02",
+	"20060102150405",
+	"20060102",
+	"2 January 2006",
+	"2 Jan 2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// DateFormatter parses a date and formats it with a strftime layout. Time values produced by
+// intrinsics such as $mtime use the RFC3339 format, dates extracted by props are parsed with the
+// input layout or, when the input layout is empty, with the first of the common layouts that
+// matches the value. The formatter is called with the @ character, followed by an optional input
+// layout and >, the output layout, and an optional time zone after ~: $aired[@%d.%m.%Y>%Y-%m-%d~UTC]
+type DateFormatter struct {
+	InLayout  string
+	OutLayout string
+	// Zone is the name of the time zone the date is converted to, empty to keep the zone of the value
+	Zone     string
+	location *time.Location
+	input    *strftimeInput
+}
+
+// NewDateFormatter creates a new date formatter. The layouts are validated and the time zone is loaded
+// from the system time zone database.
+func NewDateFormatter(in, out, zone string) (DateFormatter, error) {
+	var input *strftimeInput
+	if in != "" {
+		var err error
+		if input, err = newStrftimeInput(in); err != nil {
+			return DateFormatter{}, err
+		}
+	}
+	if err := validateStrftime(out); err != nil {
+		return DateFormatter{}, err
+	}
+	var location *time.Location
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return DateFormatter{}, fmt.Errorf("Unknown time zone %s", zone)
+		}
+		location = loc
+	}
+	return DateFormatter{
+		InLayout:  in,
+		OutLayout: out,
+		Zone:      zone,
+		location:  location,
+		input:     input,
+	}, nil
+}
+
+// Format parses the given value as a date and formats it with the output layout. Empty values are
+// returned unchanged, as are values that are not a date along with a DateParseError.
+func (f *DateFormatter) Format(value string, rstate renamerState) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := f.parse(value)
+	if err != nil {
+		return value, err
+	}
+	if f.location != nil {
+		t = t.In(f.location)
+	}
+	return formatStrftime(t, f.OutLayout), nil
+}
+
+func (f *DateFormatter) parse(value string) (time.Time, error) {
+	if f.InLayout != "" {
+		if f.input == nil {
+			input, err := newStrftimeInput(f.InLayout)
+			if err != nil {
+				return time.Time{}, err
+			}
+			f.input = input
+		}
+		t, err := f.input.parse(value, time.Local)
+		if err != nil {
+			return time.Time{}, &DateParseError{Value: value, Layout: f.InLayout}
+		}
+		return t, nil
+	}
+	for _, layout := range dateAutoLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &DateParseError{Value: value}
+}
+
+// DateParseError is returned by the date formatter when a value is not a date. The error is reported
+// as a warning for the file being renamed, and the value is left unchanged.
+type DateParseError struct {
+	Value string
+	// Layout is the input layout declared in the formatter, empty when the layout is detected
+	Layout string
+}
+
+func (e *DateParseError) Error() string {
+	if e.Layout != "" {
+		return fmt.Sprintf("Could not parse %q with the date layout %s", e.Value, e.Layout)
+	}
+	return fmt.Sprintf("Could not parse %q as a date, declare its layout in the date formatter: [@%%d.%%m.%%Y>%%Y-%%m-%%d]", e.Value)
+}
+
+// String returns the date formatter declaration as it appears in the output definition
+func (f *DateFormatter) String() string {
+	out := "@"
+	if f.InLayout != "" {
+		out += f.InLayout + ">"
+	}
+	out += f.OutLayout
+	if f.Zone != "" {
+		out += "~" + f.Zone
+	}
+	return out
+}
+
+// validateStrftime checks that the layout only uses supported directives. The %s directive, the
+// number of seconds since the Unix epoch, is supported in output layouts only.
+func validateStrftime(layout string) error {
+	runes := []rune(layout)
+	for idx := 0; idx < len(runes); idx++ {
+		if runes[idx] != '%' {
+			continue
+		}
+		if idx+1 >= len(runes) {
+			return &strftimeError{Pos: idx, Msg: "Trailing % in date layout, use %% for a literal %"}
+		}
+		idx++
+		if _, ok := strftimeDirectives[runes[idx]]; !ok && runes[idx] != '%' && runes[idx] != 's' {
+			return &strftimeError{Pos: idx - 1, Msg: fmt.Sprintf("Unknown date directive %%%c", runes[idx])}
+		}
+	}
+	return nil
+}
+
+// strftimeInput parses dates with a strftime input layout. Literal text in the layout is matched as
+// it is and only the runs of directives are parsed with their Go layout, so that literal text such as
+// the 13 in take13_%Y%m%d is never read as a date field.
+type strftimeInput struct {
+	// pattern matches the literal text of the layout and captures the text of each run of directives
+	pattern *regexp.Regexp
+	// layouts are the Go layouts of the runs of directives
+	layouts []string
+}
+
+// newStrftimeInput validates a strftime input layout and prepares it to parse dates
+func newStrftimeInput(layout string) (*strftimeInput, error) {
+	if err := validateStrftime(layout); err != nil {
+		return nil, err
+	}
+	expr := "^"
+	layouts := make([]string, 0)
+	literal := ""
+	run := ""
+	runes := []rune(layout)
+	for idx := 0; idx < len(runes); idx++ {
+		if runes[idx] != '%' || runes[idx+1] == '%' {
+			if run != "" {
+				expr += "(.+?)"
+				layouts = append(layouts, run)
+				run = ""
+			}
+			literal += string(runes[idx])
+			if runes[idx] == '%' {
+				idx++
+			}
+			continue
+		}
+		idx++
+		if runes[idx] == 's' {
+			return nil, &strftimeError{Pos: idx - 1, Msg: "The %s directive cannot be used in input layouts"}
+		}
+		expr += regexp.QuoteMeta(literal)
+		literal = ""
+		run += strftimeDirectives[runes[idx]]
+	}
+	if run != "" {
+		expr += "(.+?)"
+		layouts = append(layouts, run)
+	}
+	expr += regexp.QuoteMeta(literal) + "$"
+	return &strftimeInput{
+		pattern: regexp.MustCompile(expr),
+		layouts: layouts,
+	}, nil
+}
+
+// parse matches the value against the literal text of the layout and parses the text captured for
+// the directives in the given location
+func (in *strftimeInput) parse(value string, loc *time.Location) (time.Time, error) {
+	m := in.pattern.FindStringSubmatch(value)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("%q does not match the layout", value)
+	}
+	// the runs are separated by a character that is not part of any Go layout
+	return time.ParseInLocation(strings.Join(in.layouts, "|"), strings.Join(m[1:], "|"), loc)
+}
+
+// formatStrftime formats the time with the given strftime layout. Each directive is formatted on its
+// own so that literal text in the layout is never interpreted as part of a Go layout.
+func formatStrftime(t time.Time, layout string) string {
+	var out strings.Builder
+	runes := []rune(layout)
+	for idx := 0; idx < len(runes); idx++ {
+		if runes[idx] != '%' || idx+1 >= len(runes) {
+			out.WriteRune(runes[idx])
+			continue
+		}
+		idx++
+		switch runes[idx] {
+		case '%':
+			out.WriteRune('%')
+		case 's':
+			out.WriteString(strconv.FormatInt(t.Unix(), 10))
+		default:
+			out.WriteString(t.Format(strftimeDirectives[runes[idx]]))
+		}
+	}
+	return out.String()
+}
+
+// strftimeError reports an invalid directive at a position of a strftime layout
+type strftimeError struct {
+	Pos int
+	Msg string
+}
+
+func (e *strftimeError) Error() string {
+	return e.Msg
+}
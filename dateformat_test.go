@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateFormatter(t *testing.T) {
+	formatter, err := NewDateFormatter("", "%Y-%m-%d", "")
+	assert.Nil(t, err)
+	val, err := formatter.Format("2020-11-20T10:30:00+01:00", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-11-20", val)
+
+	// automatic detection of common layouts
+	for _, date := range []string{"2020.11.20", "20201120", "20 November 2020", "Nov 20, 2020"} {
+		val, err = formatter.Format(date, renamerState{})
+		assert.Nil(t, err, date)
+		assert.Equal(t, "2020-11-20", val, date)
+	}
+
+	// values that are not a date are returned unchanged
+	val, err = formatter.Format("not a date", renamerState{})
+	assert.IsType(t, &DateParseError{}, err)
+	assert.Equal(t, "not a date", val)
+
+	val, err = formatter.Format("", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+}
+
+func TestDateFormatterLayouts(t *testing.T) {
+	formatter, err := NewDateFormatter("%d.%m.%y", "%Y%m%d %%s of day %j", "")
+	assert.Nil(t, err)
+	val, err := formatter.Format("20.11.20", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "20201120 %s of day 325", val)
+
+	_, err = NewDateFormatter("%s", "%Y", "")
+	assert.NotNil(t, err)
+	_, err = NewDateFormatter("", "%Q", "")
+	assert.IsType(t, &strftimeError{}, err)
+}
+
+func TestDateFormatterLiteralInput(t *testing.T) {
+	formatter, err := NewDateFormatter("take13_%Y%m%d", "%Y-%m-%d", "")
+	assert.Nil(t, err)
+	val, err := formatter.Format("take13_20201120", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-11-20", val)
+
+	formatter, err = NewDateFormatter("Mon 1 PM %H.%M 100%% %d/%b", "%d %m %H:%M", "")
+	assert.Nil(t, err)
+	val, err = formatter.Format("Mon 1 PM 15.04 100% 05/Jan", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "05 01 15:04", val)
+
+	val, err = formatter.Format("Tue 1 PM 15.04 100% 05/Jan", renamerState{})
+	assert.IsType(t, &DateParseError{}, err)
+	assert.Equal(t, "Tue 1 PM 15.04 100% 05/Jan", val)
+}
+
+func TestDateFormatterZone(t *testing.T) {
+	formatter, err := NewDateFormatter("", "%H:%M %Z", "UTC")
+	assert.Nil(t, err)
+	val, err := formatter.Format("2020-11-20T10:30:00+01:00", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "09:30 UTC", val)
+
+	_, err = NewDateFormatter("", "%Y", "Nowhere/Atlantis")
+	assert.NotNil(t, err)
+}
+
+func TestParseDateFormatter(t *testing.T) {
+	tokens, err := ParseOutput("$aired[@%d.%m.%Y>%Y-%m-%d~UTC,>:4] $mtime[@%Y\\,%m]")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tokens))
+	assert.Equal(t, 2, len(tokens[0].Formatter))
+	date := tokens[0].Formatter[0].(*DateFormatter)
+	assert.Equal(t, "%d.%m.%Y", date.InLayout)
+	assert.Equal(t, "%Y-%m-%d", date.OutLayout)
+	assert.Equal(t, "UTC", date.Zone)
+	assert.Equal(t, "@%d.%m.%Y>%Y-%m-%d~UTC", date.String())
+	assert.Equal(t, "%Y,%m", tokens[2].Formatter[0].(*DateFormatter).OutLayout)
+
+	_, err = ParseOutput("$mtime[@%Y-%Q]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 11, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$mtime[@%Q>%Y]")
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$mtime[@]")
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseOutput("$mtime[@%Y~]")
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestNowIntrinsic(t *testing.T) {
+	rstate := renamerState{now: time.Date(2020, 11, 20, 10, 30, 0, 0, time.Local)}
+	tokens, err := ParseOutput("$now[@%Y%m%d]")
+	assert.Nil(t, err)
+	vals := VarValues{"$now": ReservedVarNames["$now"](rstate)}
+	val, _, err := GenerateName(vals, tokens, rstate, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "20201120", val)
+}
+
+func TestDateFormatterInvalidValueWarns(t *testing.T) {
+	tokens, err := ParseOutput("$aired[@%Y] - $title")
+	assert.Nil(t, err)
+	vals := VarValues{"$aired": "unknown", "$title": "Pilot"}
+	val, warnings, err := GenerateName(vals, tokens, renamerState{}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "unknown - Pilot", val)
+	assert.Equal(t, 1, len(warnings))
+	assert.Equal(t, RenameWarningTypeInvalidDate, warnings[0].Type)
+	assert.Equal(t, "WARNING: Could not parse \"unknown\" as a date, declare its layout in the date formatter: [@%d.%m.%Y>%Y-%m-%d] in file show.mkv, the value was left unchanged",
+		warnings[0].String(RenameLogEntry{OriginalFileName: "show.mkv"}))
+}
@@ -9,14 +9,94 @@ const cliDescription = "raf renames multiple files or directories in a single pa
 const propFlagDescription = "The prop flag tells raf to extract text from the original file name and store it in a variable " +
 	"that can be used to generate the new file name. A prop flag is assigned a unique name and a regular expression used to extract " +
 	"the value from the original file name: -p \"title=Video\\ \\d+\\ \\-\\ ([A-Za-z0-9\\ ]+)_\". If the regular expression collects " +
-	"a group using () only the content of the group is assigned to the variable, otherwise raf collects the entire match."
+	"a group using () only the content of the last group is assigned to the variable, otherwise raf collects the entire match. " +
+	"Each group is also available by number - $title.1 - with $title.0 containing the entire match, and named groups - (?P<show>.+) - " +
+	"define a variable with the name of the group: $show. Options in curly braces after the name select which match is used " +
+	"when the regular expression matches multiple parts of the name: -p \"tags{match=all,sep=+}=\\[(\\w+)\\]\". The match option " +
+	"accepts first (default), last, all, or the position of the match starting from 1; sep sets the separator used to join all matches. " +
+	"The default option sets the value used when the regular expression does not match, and required=skip|fail skips the file or " +
+	"stops raf when it does not match; a ! before the = is a shorthand for required=fail. The regular expression can also be declared " +
+	"as /regex/flags where flags can include i (case-insensitive), s (. matches new lines), and a (match the entire name without extension). " +
+	"To run the regular expression against the value of another property instead of the file name, prefix it with the variable name " +
+	"and a colon: -p \"word=$title:^(\\w+)\". A scope after the name runs the regular expression against a different portion of " +
+	"the file path: name (default), stem (name without extension), path (absolute path), dir (absolute path of the folder), or " +
+	"parent (name of the folder): -p \"album@parent=(.+)\"."
+
+const matchFlagDescription = "The match flag declares a pattern that the entire file name must match and extracts the values of its " +
+	"placeholders into variables: -m '{show}.S{season:int}E{ep:int}.{quality}{ext}' makes $show, $season, $ep, and $quality available. " +
+	"Placeholders can declare a type after a colon: str (default), int, or word. The {ext} placeholder matches the extension and {} " +
+	"matches any text without storing it. Files that do not match the pattern are listed and skipped."
+
+const macrosFlagDescription = "The macros flag points to a file declaring additional macros for the regular expressions in prop " +
+	"flags. Each line declares a macro in the format \"name = regex\" and lines starting with # are ignored. When the flag is not set raf " +
+	"reads ~/.raf/macros if it exists. Macros are referenced in curly braces: -p \"aired=({date})\". Built-in macros are {date}, " +
+	"{sxxexx}, {year}, {crc}, and {resolution}."
+
+const varFlagDescription = "The var flag declares a variable whose value is generated from a template that follows the same syntax " +
+	"as the output, including formatters: --var 'base=$show[/\\./ /] S$season[%02]' makes $base available to the output and to other " +
+	"variables. Variables cannot reference each other in a cycle or reuse the name of a property or capture group."
+
+const compoundExtFlagDescription = "The compound-ext flag declares an extension made of multiple parts, such as .tar.gz, that the " +
+	"$fullext intrinsic recognizes. The flag can be repeated and replaces the default list: .tar.gz, .tar.bz2, .tar.xz, .tar.zst, and .tar.lz."
+
+const cntFlagDescription = "The cnt flag configures the $cnt counter with a comma separated list of options: start sets the first " +
+	"value, step the increment - negative steps count down to 1 -, width zero-pads the counter to a number of digits or to the digits of " +
+	"its largest value with auto, by restarts the counter for each directory (dir) or each distinct value of a property ($season), " +
+	"and mode=continue|fill continues the numbering of the existing files whose name matches the output, or fills its gaps. " +
+	"For example --cnt 'start=101,width=auto'. The same options can be declared on a single token: $cnt{start=101,by=$season}."
+
+const sortFlagDescription = "The sort flag sets the order in which files are assigned the $cnt counter: name, natural - numbers in the " +
+	"name are compared by their value so that ep2 comes before ep10 -, mtime, ctime, size, prop:<name> to compare the natural order of a " +
+	"property value, or none (default) to keep the order in which the files are passed to raf. Files that compare equal keep their order."
+
+const reverseFlagDescription = "The reverse flag inverts the sort order"
+
+const asciiFlagDescription = "The ascii flag transliterates the generated names to ASCII: accents are removed, letters such as ß are " +
+	"spelled out, and Greek, Cyrillic, kana, and hangul are romanized. Characters that cannot be transliterated are replaced with _"
+
+const normalizeFlagDescription = "The normalize flag converts the generated names to a Unicode normalization form: nfc, the composed form " +
+	"typed on most systems, nfd, the decomposed form of file names copied from macOS, or none (default). Names that only differ in their " +
+	"normalization form are always reported as collisions"
+
+const caseInsensitiveFlagDescription = "The case-insensitive flag reports names that only differ in case as collisions, for targets on " +
+	"case-insensitive file systems"
+
+const sanitizeFlagDescription = "The sanitize flag makes the generated names valid on a target platform: posix, windows, macos, portable - " +
+	"valid everywhere -, or none (default). Characters that are not allowed are replaced with _, control characters are removed, " +
+	"Windows device names such as CON get a _ suffix, trailing dots and spaces are dropped on Windows, and names longer than 255 bytes " +
+	"are truncated keeping their extension. Invalid names are reported as warnings in dry run mode"
 
 const outputFlagDescription = "The output flag specifies the pattern to generate new file names. To include a variable it should be " +
 	"referenced with a dollar ($) sign. Additionally, variable can include formatting directives enclosed in square brackets [ ] after their " +
-	"name - see man page for more information. Raf provides the following variables: $cnt - counter of files processed starting at 1; $ext - " +
-	"extension of the original file; $fname - full name of the original file excluding its extension."
+	"name - see man page for more information. Raf provides the following variables: $cnt - counter of files processed starting at 1; $total - number of files renamed; $ext - " +
+	"extension of the original file; $extnodot - extension without the leading dot; $fullext - extension including compound " +
+	"extensions such as .tar.gz; $fname - full name of the original file including its extension; $stem - name of the original file " +
+	"without its full extension; $parent - name of the folder " +
+	"containing the file; $dir - absolute path of the folder containing the file; $relpath - path of the file relative to the working directory. The metadata intrinsics $size, $hsize, $mtime, $atime, $ctime, " +
+	"$mode, $uid, $user, $gid, $group, and $inode are read from the file only when the output references them. $now is the time raf " +
+	"started, times are formatted with the date formatter: $mtime[@%Y-%m-%d]. Segments in ${...} adapt to the available values: " +
+	"${title:-Untitled} falls back to Untitled when $title is empty, ${ - $subtitle} only appears when $subtitle has a value, and " +
+	"${title|episode} uses the first variable with a value."
 
 const dryRunFlagDescription = "Dry run mode makes raf print to stderr the operations it would perform in the format \"File <original name> " +
 	"-> <new file name>\" without actually renaming the file."
 
+const viewFlagDescription = "The view flag selects how dry run mode prints the changes: \"list\" prints a \"File <original name> -> " +
+	"<new file name>\" line per file; \"diff\" prints a single name per file highlighting the deleted, inserted, and unchanged characters; " +
+	"\"table\" prints the original and new names in two aligned columns. Long names are truncated to fit the terminal width."
+
+const colorFlagDescription = "The color flag controls colored output: \"auto\" enables colors only when stdout is a terminal and the " +
+	"NO_COLOR environment variable is not set, \"always\" forces colors, and \"never\" disables them."
+
 const undoCommandDescription = "The undo command looks for an .raf file in the working directory and reverts the file names to their original state"
+
+const reseqCommandDescription = "The reseq command renumbers a sequence of files, closing the gaps in their numbering: img_0003, " +
+	"img_0007, and img_0012 become img_0001, img_0002, and img_0003. The files are sorted by their number, the missing numbers are " +
+	"reported, and the files are renamed through temporary names so that overlapping names are not overwritten: raf reseq FILES"
+
+const reseqPropFlagDescription = "The prop flag selects the number to renumber in each file name with a property definition, the " +
+	"last capture group of the match selected by its match option is used: -p \"num=img_(\\d+)\". When the flag is not set, raf uses the last number in the name without its extension."
+
+const explainCommandDescription = "The explain command prints, for each file, the tokens parsed from the output definition, the portions " +
+	"of the name matched by each property and their capture groups, the value of each property after every formatter in its pipeline, " +
+	"the tokens that generated warnings, and the problems that make the new name invalid. The command does not rename files: raf explain -p \"title=...\" -o '...' FILES"
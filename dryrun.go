@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+const (
+	// DryRunViewList prints one "File <original> -> <new>" line per file. This is the default view
+	DryRunViewList = "list"
+	// DryRunViewDiff prints a single line per file highlighting the segments of the name that were
+	// deleted, inserted, or left unchanged, similar to git diff --word-diff
+	DryRunViewDiff = "diff"
+	// DryRunViewTable prints the original and new names in two aligned columns
+	DryRunViewTable = "table"
+)
+
+const (
+	// ColorModeAuto enables colors only when stdout is a terminal and the NO_COLOR environment
+	// variable is not set
+	ColorModeAuto = "auto"
+	// ColorModeAlways forces colored output
+	ColorModeAlways = "always"
+	// ColorModeNever disables colored output
+	ColorModeNever = "never"
+)
+
+const (
+	diffOpEqual = iota
+	diffOpDelete
+	diffOpInsert
+)
+
+// diffSegment is a portion of a name produced by the diffNames function. The op field tells whether
+// the text was removed from the original name, added in the new name, or left unchanged
+type diffSegment struct {
+	op   int
+	text string
+}
+
+// dryRunPrinter renders the output of a dry run execution in the configured view
+type dryRunPrinter struct {
+	view  string
+	width int
+	out   io.Writer
+}
+
+// configureColor sets the global color mode for the output based on the value of the --color flag.
+// In auto mode colors are disabled if the NO_COLOR environment variable is set or stdout is not a
+// terminal
+func configureColor(mode string) error {
+	switch mode {
+	case ColorModeAlways:
+		color.NoColor = false
+	case ColorModeNever:
+		color.NoColor = true
+	case ColorModeAuto, "":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		color.NoColor = noColor || !term.IsTerminal(int(os.Stdout.Fd()))
+	default:
+		return fmt.Errorf("Invalid color mode %s, supported values are %s, %s, and %s", mode, ColorModeAuto, ColorModeAlways, ColorModeNever)
+	}
+	return nil
+}
+
+// terminalWidth returns the width of the terminal attached to stdout. If stdout is not a terminal
+// the function returns 0, meaning output should not be truncated
+func terminalWidth() int {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+func newDryRunPrinter(view string, width int, out io.Writer) (*dryRunPrinter, error) {
+	switch view {
+	case "":
+		view = DryRunViewList
+	case DryRunViewList, DryRunViewDiff, DryRunViewTable:
+	default:
+		return nil, fmt.Errorf("Invalid dry run view %s, supported values are %s, %s, and %s", view, DryRunViewList, DryRunViewDiff, DryRunViewTable)
+	}
+	return &dryRunPrinter{
+		view:  view,
+		width: width,
+		out:   out,
+	}, nil
+}
+
+// Print writes the changes recorded in the rename log in the configured view
+func (p *dryRunPrinter) Print(rlog RenameLog) {
+	switch p.view {
+	case DryRunViewDiff:
+		for _, e := range rlog {
+			p.printDiff(e.OriginalFileName, e.NewFileName)
+		}
+	case DryRunViewTable:
+		p.printTable(rlog)
+	default:
+		for _, e := range rlog {
+			from, to := e.OriginalFileName, e.NewFileName
+			if p.width > 0 {
+				fromWidth, toWidth := fitColumns(textLength(from, true), textLength(to, true), p.width-len("File  -> "))
+				from, to = truncateName(from, fromWidth), truncateName(to, toWidth)
+			}
+			dryRunPrint(p.out, from, to)
+		}
+	}
+}
+
+func (p *dryRunPrinter) printDiff(from, to string) {
+	red := color.New(color.FgHiRed, color.CrossedOut).SprintFunc()
+	green := color.New(color.FgGreen, color.Underline).SprintFunc()
+
+	segments := diffNames(from, to)
+	if p.width > 0 {
+		segments = truncateSegments(segments, p.width)
+	}
+	line := ""
+	for _, s := range segments {
+		switch s.op {
+		case diffOpDelete:
+			if color.NoColor {
+				line += "[-" + s.text + "-]"
+			} else {
+				line += red(s.text)
+			}
+		case diffOpInsert:
+			if color.NoColor {
+				line += "{+" + s.text + "+}"
+			} else {
+				line += green(s.text)
+			}
+		default:
+			line += s.text
+		}
+	}
+	fmt.Fprintln(p.out, line)
+}
+
+func (p *dryRunPrinter) printTable(rlog RenameLog) {
+	red := color.New(color.FgHiRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	const separator = " -> "
+
+	fromWidth := 0
+	toWidth := 0
+	for _, e := range rlog {
+		if l := textLength(e.OriginalFileName, true); l > fromWidth {
+			fromWidth = l
+		}
+		if l := textLength(e.NewFileName, true); l > toWidth {
+			toWidth = l
+		}
+	}
+	if p.width > 0 {
+		fromWidth, toWidth = fitColumns(fromWidth, toWidth, p.width-len(separator))
+	}
+
+	for _, e := range rlog {
+		from := truncateName(e.OriginalFileName, fromWidth)
+		to := truncateName(e.NewFileName, toWidth)
+		padding := ""
+		if n := fromWidth - textLength(from, true); n > 0 {
+			padding = strings.Repeat(" ", n)
+		}
+		fmt.Fprintf(p.out, "%s%s%s%s\n", red(from), padding, separator, green(to))
+	}
+}
+
+// fitColumns shares the available terminal columns between the original and the new name when they
+// do not fit side by side. Each name keeps at least one column, so on very narrow terminals the line
+// can still be wider than available.
+func fitColumns(fromWidth, toWidth, available int) (int, int) {
+	if fromWidth+toWidth <= available {
+		return fromWidth, toWidth
+	}
+	half := available / 2
+	switch {
+	case fromWidth > half && toWidth > half:
+		fromWidth = half
+		toWidth = available - half
+	case fromWidth > half:
+		fromWidth = available - toWidth
+	default:
+		toWidth = available - fromWidth
+	}
+	if fromWidth < 1 {
+		fromWidth = 1
+	}
+	if toWidth < 1 {
+		toWidth = 1
+	}
+	return fromWidth, toWidth
+}
+
+// dryRunPrint writes a single "File <original> -> <new>" line to the given writer
+func dryRunPrint(out io.Writer, from, to string) {
+	red := color.New(color.FgHiRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	fmt.Fprintf(out, "File %s -> %s\n", red(from), green(to))
+}
+
+// truncateName cuts a name to the given number of terminal columns, replacing the end of the name with
+// an ellipsis when the name is too long. Wide characters count as two columns and are never split.
+func truncateName(name string, width int) string {
+	if width <= 0 || textLength(name, true) <= width {
+		return name
+	}
+	return truncateColumns(name, width-1) + "…"
+}
+
+// truncateColumns returns the longest prefix of the value that fits in the given number of columns
+func truncateColumns(value string, columns int) string {
+	out := ""
+	used := 0
+	for _, g := range graphemes(value) {
+		w := displayWidth(g)
+		if used+w > columns {
+			break
+		}
+		out += g
+		used += w
+	}
+	return out
+}
+
+// truncateSegments drops the text of the diff segments that go beyond the given width and terminates
+// the last segment with an ellipsis. The diff markers printed when colors are disabled are not counted.
+func truncateSegments(segments []diffSegment, width int) []diffSegment {
+	total := 0
+	for _, s := range segments {
+		total += textLength(s.text, true)
+	}
+	if total <= width {
+		return segments
+	}
+
+	out := make([]diffSegment, 0)
+	remaining := width - 1 // leave room for the ellipsis
+	for _, s := range segments {
+		length := textLength(s.text, true)
+		if length >= remaining {
+			out = append(out, diffSegment{op: s.op, text: truncateColumns(s.text, remaining) + "…"})
+			break
+		}
+		out = append(out, s)
+		remaining -= length
+	}
+	return out
+}
+
+// diffNames computes a character level diff between the original and new name. The diff is based on
+// the longest common subsequence of the two names. Short unchanged segments between two changes are
+// folded into the changes to make the output easier to read.
+func diffNames(from, to string) []diffSegment {
+	a := []rune(from)
+	b := []rune(to)
+
+	// lcs[i][j] contains the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	segments := make([]diffSegment, 0)
+	appendOp := func(op int, chr rune) {
+		if len(segments) > 0 && segments[len(segments)-1].op == op {
+			segments[len(segments)-1].text += string(chr)
+			return
+		}
+		segments = append(segments, diffSegment{op: op, text: string(chr)})
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			appendOp(diffOpEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			appendOp(diffOpDelete, a[i])
+			i++
+		default:
+			appendOp(diffOpInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		appendOp(diffOpDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		appendOp(diffOpInsert, b[j])
+	}
+
+	return cleanupSegments(segments)
+}
+
+// cleanupSegments folds unchanged segments shorter than 3 characters that sit between two changes into
+// the surrounding changes and groups all deletions before insertions within a change
+func cleanupSegments(segments []diffSegment) []diffSegment {
+	out := make([]diffSegment, 0)
+	deleted := ""
+	inserted := ""
+	flush := func() {
+		if deleted != "" {
+			out = append(out, diffSegment{op: diffOpDelete, text: deleted})
+		}
+		if inserted != "" {
+			out = append(out, diffSegment{op: diffOpInsert, text: inserted})
+		}
+		deleted = ""
+		inserted = ""
+	}
+	for idx, s := range segments {
+		switch s.op {
+		case diffOpDelete:
+			deleted += s.text
+		case diffOpInsert:
+			inserted += s.text
+		default:
+			inChange := deleted != "" || inserted != ""
+			if inChange && idx < len(segments)-1 && len([]rune(s.text)) < 3 {
+				deleted += s.text
+				inserted += s.text
+				continue
+			}
+			flush()
+			out = append(out, s)
+		}
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffNames(t *testing.T) {
+	segments := diffNames("Wedding - 1 - Home.mkv", "Wedding - 001 - Home.mkv")
+	assert.Equal(t, []diffSegment{
+		{op: diffOpEqual, text: "Wedding - "},
+		{op: diffOpInsert, text: "00"},
+		{op: diffOpEqual, text: "1 - Home.mkv"},
+	}, segments)
+
+	segments = diffNames("video.avi", "video.mkv")
+	assert.Equal(t, []diffSegment{
+		{op: diffOpEqual, text: "video."},
+		{op: diffOpDelete, text: "avi"},
+		{op: diffOpInsert, text: "mkv"},
+	}, segments)
+
+	segments = diffNames("same", "same")
+	assert.Equal(t, []diffSegment{{op: diffOpEqual, text: "same"}}, segments)
+}
+
+func TestDiffNamesFoldsShortEqualSegments(t *testing.T) {
+	// the "e" shared by both names should not be shown as unchanged
+	segments := diffNames("abcdef", "xyzeuv")
+	assert.Equal(t, []diffSegment{
+		{op: diffOpDelete, text: "abcdef"},
+		{op: diffOpInsert, text: "xyzeuv"},
+	}, segments)
+}
+
+func TestDryRunDiffView(t *testing.T) {
+	color.NoColor = true
+	out := bytes.Buffer{}
+	printer, err := newDryRunPrinter(DryRunViewDiff, 0, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{{OriginalFileName: "video.avi", NewFileName: "video.mkv"}})
+	assert.Equal(t, "video.[-avi-]{+mkv+}\n", out.String())
+}
+
+func TestDryRunTableView(t *testing.T) {
+	color.NoColor = true
+	out := bytes.Buffer{}
+	printer, err := newDryRunPrinter(DryRunViewTable, 0, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{
+		{OriginalFileName: "a.avi", NewFileName: "1.mkv"},
+		{OriginalFileName: "long.avi", NewFileName: "2.mkv"},
+	})
+	assert.Equal(t, "a.avi    -> 1.mkv\nlong.avi -> 2.mkv\n", out.String())
+
+	out.Reset()
+	printer, err = newDryRunPrinter(DryRunViewTable, 14, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{{OriginalFileName: "original.avi", NewFileName: "renamed.mkv"}})
+	assert.Equal(t, "orig… -> rena…\n", out.String())
+
+	// wide characters take two columns and narrow terminals must not break the alignment
+	out.Reset()
+	printer, err = newDryRunPrinter(DryRunViewTable, 14, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{{OriginalFileName: "\u6620\u753b\u306e\u30d5\u30a1\u30a4\u30eb.avi", NewFileName: "a.mkv"}})
+	assert.Equal(t, "\u6620\u753b… -> a.mkv\n", out.String())
+
+	out.Reset()
+	printer, err = newDryRunPrinter(DryRunViewTable, 3, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{
+		{OriginalFileName: "\u6620\u753b.avi", NewFileName: "1.mkv"},
+		{OriginalFileName: "a", NewFileName: "2.mkv"},
+	})
+	assert.Equal(t, "… -> …\na -> …\n", out.String())
+}
+
+func TestDryRunListView(t *testing.T) {
+	color.NoColor = true
+	out := bytes.Buffer{}
+	printer, err := newDryRunPrinter(DryRunViewList, 0, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{{OriginalFileName: "original.avi", NewFileName: "renamed.mkv"}})
+	assert.Equal(t, "File original.avi -> renamed.mkv\n", out.String())
+
+	out.Reset()
+	printer, err = newDryRunPrinter(DryRunViewList, 19, &out)
+	assert.Nil(t, err)
+	printer.Print(RenameLog{{OriginalFileName: "original.avi", NewFileName: "renamed.mkv"}})
+	assert.Equal(t, "File orig… -> rena…\n", out.String())
+}
+
+func TestDryRunInvalidView(t *testing.T) {
+	_, err := newDryRunPrinter("columns", 0, &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
+
+func TestConfigureColor(t *testing.T) {
+	assert.Nil(t, configureColor(ColorModeAlways))
+	assert.False(t, color.NoColor)
+	assert.Nil(t, configureColor(ColorModeNever))
+	assert.True(t, color.NoColor)
+
+	color.NoColor = false
+	os.Setenv("NO_COLOR", "1")
+	assert.Nil(t, configureColor(ColorModeAuto))
+	assert.True(t, color.NoColor)
+	os.Unsetenv("NO_COLOR")
+
+	assert.NotNil(t, configureColor("sometimes"))
+}
+
+func TestTruncateSegments(t *testing.T) {
+	segments := truncateSegments([]diffSegment{
+		{op: diffOpEqual, text: "abc"},
+		{op: diffOpInsert, text: "defgh"},
+	}, 6)
+	assert.Equal(t, []diffSegment{
+		{op: diffOpEqual, text: "abc"},
+		{op: diffOpInsert, text: "de…"},
+	}, segments)
+
+	segments = truncateSegments([]diffSegment{{op: diffOpInsert, text: "\u6620\u753b\u306e"}}, 4)
+	assert.Equal(t, []diffSegment{{op: diffOpInsert, text: "\u6620…"}}, segments)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// ParseError is returned when an output definition or a property declaration cannot be parsed. The
+// error records the position of the invalid character in the input string and, when raf can find a
+// likely candidate, a suggestion for the correct value.
+type ParseError struct {
+	// Input is the full string that was being parsed
+	Input string
+	// Pos is the index of the invalid character in the input, counted in runes
+	Pos int
+	// Msg describes the error
+	Msg string
+	// Suggestion is a possible replacement for the invalid value, for example the name of a declared
+	// property with a similar name
+	Suggestion string
+}
+
+// Error returns the error message followed by the input string and a caret under the invalid character
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s at column %d", e.Msg, e.Pos+1)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean `%s`?", e.Suggestion)
+	}
+	return msg + "\n  " + e.Input + "\n  " + strings.Repeat(" ", e.Pos) + "^"
+}
+
+func newParseError(input string, pos int, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Input: input,
+		Pos:   pos,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+// regexErrorPos returns the position, in runes, of the portion of the pattern that caused the regexp
+// compilation error and a message describing the error. If the position cannot be determined the
+// function returns 0.
+func regexErrorPos(pattern string, err error) (int, string) {
+	syntaxErr, ok := err.(*syntax.Error)
+	if !ok {
+		return 0, err.Error()
+	}
+	msg := syntaxErr.Code.String()
+	if syntaxErr.Expr == "" {
+		return 0, msg
+	}
+	msg += fmt.Sprintf(": `%s`", syntaxErr.Expr)
+	byteIdx := strings.Index(pattern, syntaxErr.Expr)
+	if byteIdx < 0 {
+		return 0, msg
+	}
+	return len([]rune(pattern[:byteIdx])), msg
+}
+
+// suggest returns the candidate with the shortest edit distance from the given value. If none of the
+// candidates is close enough to be a plausible typo the function returns an empty string.
+func suggest(value string, candidates []string) string {
+	best := ""
+	bestDistance := -1
+	for _, c := range candidates {
+		d := editDistance(strings.ToLower(value), strings.ToLower(c))
+		if bestDistance < 0 || d < bestDistance || (d == bestDistance && c < best) {
+			best = c
+			bestDistance = d
+		}
+	}
+	maxDistance := len([]rune(value)) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	if bestDistance < 0 || bestDistance > maxDistance {
+		return ""
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Explain prints a detailed report of how raf would generate the new name for each of the given files.
+// For each file, the report includes the portions of the name matched by each Prop regex, including
+// the position of capture groups, the value of each Var, the value of each token in the output along with the intermediate
+// values produced by its formatting pipeline, the tokens that caused warnings, and the
+// problems that make the new name invalid on the target platform.
+func Explain(p []Prop, vars []Var, tokens TokenStream, files []string, opts Opts, w io.Writer) error {
+	jobs, err := prepareRename(p, vars, tokens, files, opts)
+	if err != nil {
+		return err
+	}
+
+	platform := validationPlatform(opts)
+	fmt.Fprintln(w, "Output tokens:")
+	for idx, t := range tokens {
+		fmt.Fprintf(w, "  [%d] %s\n", idx, describeToken(t))
+	}
+
+	for _, job := range jobs {
+		fmt.Fprintf(w, "\nFile: %s\n", job.state.fileName)
+
+		if len(p) > 0 {
+			fmt.Fprintln(w, "  Props:")
+		}
+		for _, prop := range p {
+			explainProp(w, prop, prop.sourceValue(job.state, job.varValues))
+		}
+
+		if len(vars) > 0 {
+			fmt.Fprintln(w, "  Vars:")
+		}
+		for _, v := range vars {
+			fmt.Fprintf(w, "    $%s = %q from %s\n", v.Name, job.varValues["$"+v.Name], v.Template)
+		}
+		for _, warning := range job.warnings {
+			fmt.Fprintf(w, "    %s\n", warning.String(RenameLogEntry{OriginalFileName: job.state.fileName}))
+		}
+
+		traces := make([]tokenTrace, 0)
+		outName, _, err := generateName(job.varValues, tokens, job.state, opts, &traces)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, "  Tokens:")
+		for idx, trace := range traces {
+			explainTrace(w, idx, trace)
+		}
+
+		for idx, trace := range traces {
+			for _, warning := range trace.Warnings {
+				fmt.Fprintf(w, "  Token [%d] %s: %s\n", idx, trace.Token.Value, warning.String(RenameLogEntry{OriginalFileName: job.state.fileName}))
+			}
+		}
+		for _, problem := range ValidateName(outName, platform) {
+			warning := RenameWarning{Type: RenameWarningTypeInvalidName, Value: problem}
+			fmt.Fprintf(w, "  %s\n", warning.String(RenameLogEntry{OriginalFileName: job.state.fileName, NewFileName: outName}))
+		}
+		fmt.Fprintf(w, "  Result: %s\n", outName)
+	}
+	return nil
+}
+
+func explainProp(w io.Writer, prop Prop, fileName string) {
+	source := ""
+	if prop.Source != "" {
+		source = " from " + prop.Source
+	} else if prop.Scope != "" {
+		source = " on " + prop.Scope
+	}
+	fmt.Fprintf(w, "    $%s /%s/%s%s\n", prop.Name, prop.Matcher, prop.Flags, source)
+	matches := prop.Regex.FindAllStringSubmatchIndex(fileName, -1)
+	if matches == nil {
+		fmt.Fprintln(w, "      no match")
+		return
+	}
+	for midx, m := range matches {
+		used := ""
+		if isMatchUsed(prop, midx, len(matches)) {
+			used = " (used)"
+		}
+		fmt.Fprintf(w, "      match %d: %q [%d:%d]%s\n", midx+1, fileName[m[0]:m[1]], m[0], m[1], used)
+		for gidx := 1; gidx < len(m)/2; gidx++ {
+			start, end := m[gidx*2], m[gidx*2+1]
+			if start < 0 {
+				fmt.Fprintf(w, "        group %d: not matched\n", gidx)
+				continue
+			}
+			groupName := ""
+			if name := prop.Regex.SubexpNames()[gidx]; name != "" {
+				groupName = " ($" + name + ")"
+			}
+			fmt.Fprintf(w, "        group %d%s: %q [%d:%d]\n", gidx, groupName, fileName[start:end], start, end)
+		}
+	}
+}
+
+// isMatchUsed tells whether the match at the given index is used to populate the prop variables
+func isMatchUsed(prop Prop, idx, count int) bool {
+	switch prop.Match {
+	case PropMatchAll:
+		return true
+	case PropMatchLast:
+		return idx == count-1
+	case PropMatchFirst:
+		return idx == 0
+	default:
+		return idx == prop.Match-1
+	}
+}
+
+func explainTrace(w io.Writer, idx int, trace tokenTrace) {
+	if trace.Token.Type == TokenTypeLiteral {
+		fmt.Fprintf(w, "    [%d] literal %q\n", idx, trace.Output)
+		return
+	}
+	fmt.Fprintf(w, "    [%d] %s = %q\n", idx, trace.Token.Value, trace.Value)
+	for fidx, step := range trace.Steps {
+		fmt.Fprintf(w, "          %s -> %q\n", describeFormatter(trace.Token.Formatter[fidx]), step)
+	}
+}
+
+func describeToken(t Token) string {
+	if t.Type == TokenTypeLiteral {
+		return fmt.Sprintf("literal %q", t.Value)
+	}
+	out := "property " + counterKey(t)
+	if t.Type == TokenTypeGroup {
+		out = "group " + t.Value
+	}
+	if len(t.Formatter) > 0 {
+		formatters := make([]string, len(t.Formatter))
+		for idx, f := range t.Formatter {
+			formatters[idx] = describeFormatter(f)
+		}
+		out += " [" + strings.Join(formatters, ",") + "]"
+	}
+	return out
+}
+
+func describeFormatter(f Formatter) string {
+	if s, ok := f.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", f)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	p, err := NewProp("title", "\\d\\ \\-\\ ([A-Za-z]+)\\.mkv")
+	assert.Nil(t, err)
+	tokens, err := ParseOutput("test - $cnt[%03] - $title[/o/0/,>:3]$ext")
+	assert.Nil(t, err)
+
+	out := bytes.Buffer{}
+	err = Explain([]Prop{p}, nil, tokens, []string{"Wedding - 1 - Home.mkv", "Wedding - 2 - _Party.mkv"}, Opts{}, &out)
+	assert.Nil(t, err)
+
+	report := out.String()
+	assert.Contains(t, report, "  [1] property $cnt [%03]\n")
+	assert.Contains(t, report, "  [3] property $title [/o/0/,>:3]\n")
+	assert.Contains(t, report, "File: Wedding - 1 - Home.mkv\n")
+	assert.Contains(t, report, "      match 1: \"1 - Home.mkv\" [10:22] (used)\n")
+	assert.Contains(t, report, "        group 1: \"Home\" [14:18]\n")
+	assert.Contains(t, report, "    [3] $title = \"Home\"\n          /o/0/ -> \"H0me\"\n          >:3 -> \"H0m\"\n")
+	assert.Contains(t, report, "  Result: test - 001 - H0m.mkv\n")
+
+	// the second file does not match the title prop
+	assert.Contains(t, report, "      no match\n")
+	assert.Contains(t, report, "  Token [3] $title: WARNING: Could not extract property $title from original file name: Wedding - 2 - _Party.mkv")
+}
+
+func TestExplainInvalidName(t *testing.T) {
+	name := strings.Repeat("a", MaxNameBytes) + ".mkv"
+	tokens, err := ParseOutput(strings.Repeat("a", MaxNameBytes) + "$ext")
+	assert.Nil(t, err)
+
+	out := bytes.Buffer{}
+	err = Explain(nil, nil, tokens, []string{"Show.mkv"}, Opts{}, &out)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), fmt.Sprintf("  WARNING: New file name %s is %d bytes long, the limit is %d\n", name, len(name), MaxNameBytes))
+
+	// sanitized names are valid
+	out = bytes.Buffer{}
+	err = Explain(nil, nil, tokens, []string{"Show.mkv"}, Opts{Sanitize: SanitizePosix}, &out)
+	assert.Nil(t, err)
+	assert.NotContains(t, out.String(), "WARNING: New file name")
+}
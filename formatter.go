@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -14,11 +16,24 @@ type Formatter interface {
 	Format(string, renamerState) (string, error)
 }
 
+const (
+	// PadAlignRight pads the value on the left. This is the default
+	PadAlignRight = iota
+	// PadAlignLeft pads the value on the right
+	PadAlignLeft
+	// PadAlignCenter pads the value on both sides
+	PadAlignCenter
+)
+
 // PaddingFormatter can pad a value with another character. For example, it can be used to zero-pad
-// the counter: $cnt[%03]
+// the counter: $cnt[%03]. The length of the value is measured in characters, and in terminal columns
+// when DisplayWidth is set so that East Asian wide characters count twice.
 type PaddingFormatter struct {
 	PadCharacter rune
 	PadLength    int
+	// Align is PadAlignRight, PadAlignLeft, or PadAlignCenter
+	Align        int
+	DisplayWidth bool
 }
 
 // NewPaddingFormatter creates a new padding formatter that pads a property with the given char up
@@ -32,18 +47,39 @@ func NewPaddingFormatter(char rune, length int) PaddingFormatter {
 
 // Format applies padding to the given value with the character configured
 func (f *PaddingFormatter) Format(value string, rstate renamerState) (string, error) {
-	if len(value) >= f.PadLength {
+	length := textLength(value, f.DisplayWidth)
+	if length >= f.PadLength {
 		return value, nil
 	}
 
-	newValue := ""
-	idx := 0
-	for idx < f.PadLength-len(value) {
-		newValue += string(f.PadCharacter)
-		idx++
+	padWidth := 1
+	if f.DisplayWidth {
+		padWidth = displayWidth(string(f.PadCharacter))
+	}
+	pad := (f.PadLength - length) / padWidth
+	switch f.Align {
+	case PadAlignLeft:
+		return value + strings.Repeat(string(f.PadCharacter), pad), nil
+	case PadAlignCenter:
+		left := pad / 2
+		return strings.Repeat(string(f.PadCharacter), left) + value + strings.Repeat(string(f.PadCharacter), pad-left), nil
+	}
+	return strings.Repeat(string(f.PadCharacter), pad) + value, nil
+}
+
+// String returns the padding formatter declaration as it appears in the output definition
+func (f *PaddingFormatter) String() string {
+	out := "%" + string(f.PadCharacter) + strconv.Itoa(f.PadLength)
+	switch f.Align {
+	case PadAlignLeft:
+		out += "<"
+	case PadAlignCenter:
+		out += "^"
 	}
-	newValue += value
-	return newValue, nil
+	if f.DisplayWidth {
+		out += "w"
+	}
+	return out
 }
 
 // SliceFormatter can cut a substring out of a value. The slice formatter is called with the &gt;
@@ -51,7 +87,8 @@ func (f *PaddingFormatter) Format(value string, rstate renamerState) (string, er
 // and the end index. If either value is left blank the system assumes 0 for the beginning and max
 // for the end. For example, >:10 declares a formatter that cuts values to a maximum length of 10
 // characters. If the starting index is higher than the length of the value the formatter will return
-// an empty string.
+// an empty string. Indexes count characters, accented letters and other multi-byte characters are
+// never split.
 type SliceFormatter struct {
 	Start int
 	End   int
@@ -67,7 +104,8 @@ func NewSliceFormatter(start, end int) SliceFormatter {
 
 // Format trims the string to the start and end points specified by the SliceFormatter
 func (f *SliceFormatter) Format(value string, rstate renamerState) (string, error) {
-	strlen := len(value)
+	chars := graphemes(value)
+	strlen := len(chars)
 	strstart := 0
 	if f.Start > 0 {
 		strstart = f.Start
@@ -78,21 +116,62 @@ func (f *SliceFormatter) Format(value string, rstate renamerState) (string, erro
 	if f.End > 0 && f.End < strlen {
 		strlen = f.End
 	}
-	return value[strstart:strlen], nil
+	if strstart > strlen {
+		return "", nil
+	}
+	return strings.Join(chars[strstart:strlen], ""), nil
+}
+
+// String returns the slice formatter declaration as it appears in the output definition
+func (f *SliceFormatter) String() string {
+	out := ">"
+	if f.Start >= 0 {
+		out += strconv.Itoa(f.Start)
+	}
+	out += ":"
+	if f.End >= 0 {
+		out += strconv.Itoa(f.End)
+	}
+	return out
 }
 
+const (
+	// ReplaceFlagIgnoreCase makes the pattern of the replacing formatter case-insensitive
+	ReplaceFlagIgnoreCase = 'i'
+	// ReplaceFlagFirst only replaces the first match of the pattern
+	ReplaceFlagFirst = 'f'
+)
+
 // ReplacingFormatter portions of a property's value that match the Pattern property with the
-// string Value.
+// string Value. The Value can reference the capture groups of the pattern with $1 or ${name}, as in
+// regexp.Regexp.Expand. Flags can make the pattern case-insensitive and restrict the replacement to
+// the first match: /find/replace/if.
 type ReplacingFormatter struct {
 	Pattern       *regexp.Regexp
 	PatternString string
 	Value         string
+	Flags         string
 }
 
 // NewReplacingFormatter creates a new replacing formatter and attempts to compile the given from
 // string into a regular expression
 func NewReplacingFormatter(from, to string) (ReplacingFormatter, error) {
-	regex, err := regexp.Compile(from)
+	return NewReplacingFormatterWithFlags(from, to, "")
+}
+
+// NewReplacingFormatterWithFlags creates a new replacing formatter with the given flags, each flag
+// is a single character: ReplaceFlagIgnoreCase or ReplaceFlagFirst
+func NewReplacingFormatterWithFlags(from, to, flags string) (ReplacingFormatter, error) {
+	for _, flag := range flags {
+		if flag != ReplaceFlagIgnoreCase && flag != ReplaceFlagFirst {
+			return ReplacingFormatter{}, fmt.Errorf("Unknown replacing formatter flag %s, supported flags are i and f", string(flag))
+		}
+	}
+	expr := from
+	if strings.ContainsRune(flags, ReplaceFlagIgnoreCase) {
+		expr = "(?i)" + from
+	}
+	regex, err := regexp.Compile(expr)
 	if err != nil {
 		return ReplacingFormatter{}, err
 	}
@@ -100,19 +179,24 @@ func NewReplacingFormatter(from, to string) (ReplacingFormatter, error) {
 		Pattern:       regex,
 		PatternString: from,
 		Value:         to,
+		Flags:         flags,
 	}, nil
 }
 
 // Format performs the replacement of the matched values in the given value string
 func (f *ReplacingFormatter) Format(value string, rstate renamerState) (string, error) {
-	matches := f.Pattern.FindAllStringSubmatch(value, -1)
-	if matches == nil {
-		return value, nil
+	if !strings.ContainsRune(f.Flags, ReplaceFlagFirst) {
+		return f.Pattern.ReplaceAllString(value, f.Value), nil
 	}
-	outValue := value
-	for _, m := range matches {
-		match := m[len(m)-1]
-		outValue = strings.ReplaceAll(outValue, match, f.Value)
+	match := f.Pattern.FindStringSubmatchIndex(value)
+	if match == nil {
+		return value, nil
 	}
-	return outValue, nil
+	out := f.Pattern.ExpandString([]byte(value[:match[0]]), f.Value, value, match)
+	return string(out) + value[match[1]:], nil
+}
+
+// String returns the replacing formatter declaration as it appears in the output definition
+func (f *ReplacingFormatter) String() string {
+	return "/" + f.PatternString + "/" + strings.ReplaceAll(f.Value, "/", "\\/") + "/" + f.Flags
 }
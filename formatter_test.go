@@ -25,6 +25,42 @@ func TestValueLongerThanPadding(t *testing.T) {
 	assert.Equal(t, "1234", formatted)
 }
 
+func TestPaddingAlignment(t *testing.T) {
+	formatter := NewPaddingFormatter('-', 5)
+	formatter.Align = PadAlignLeft
+	formatted, err := formatter.Format("ab", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "ab---", formatted)
+
+	formatter.Align = PadAlignCenter
+	formatted, err = formatter.Format("ab", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "-ab--", formatted)
+	assert.Equal(t, "%-5^", formatter.String())
+}
+
+func TestPaddingMultiByte(t *testing.T) {
+	formatter := NewPaddingFormatter('_', 6)
+	formatted, err := formatter.Format("Café", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "__Café", formatted)
+
+	// e followed by a combining acute accent is a single character
+	formatted, err = formatter.Format("Cafe\u0301", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "__Cafe\u0301", formatted)
+
+	formatted, err = formatter.Format("東京", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "____東京", formatted)
+
+	formatter.DisplayWidth = true
+	formatted, err = formatter.Format("東京", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "__東京", formatted)
+	assert.Equal(t, "%_6w", formatter.String())
+}
+
 func TestSliceFormatter(t *testing.T) {
 	testStr := "testing new string"
 	formatter := NewSliceFormatter(-1, 10)
@@ -66,16 +102,66 @@ func TestReplacingFormatter(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "lowercase word, lowercase. word!", val)
 
-	// capturing group
-	formatter, err = NewReplacingFormatter("\\ \\-\\ ([A-Z][a-z]+)\\ \\-\\ ", "word")
+	// capturing group, the whole match is replaced and the groups can be referenced
+	formatter, err = NewReplacingFormatter("\\ \\-\\ ([A-Z][a-z]+)\\ \\-\\ ", " - [$1] - ")
 	assert.Nil(t, err)
 	val, err = formatter.Format("video - Title - 1.mkv", renamerState{})
 	assert.Nil(t, err)
-	assert.Equal(t, "video - word - 1.mkv", val)
+	assert.Equal(t, "video - [Title] - 1.mkv", val)
 
 	val, err = formatter.Format("video - Title - 1 - First - 720p.mkv", renamerState{})
 	assert.Nil(t, err)
-	assert.Equal(t, "video - word - 1 - word - 720p.mkv", val)
+	assert.Equal(t, "video - [Title] - 1 - [First] - 720p.mkv", val)
+
+	// only the matched text is replaced, not the same text elsewhere in the value
+	formatter, err = NewReplacingFormatter("-(ep)", "E")
+	assert.Nil(t, err)
+	val, err = formatter.Format("ep-ep01", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "epE01", val)
+}
+
+func TestReplacingFormatterFlags(t *testing.T) {
+	formatter, err := NewReplacingFormatterWithFlags("(?P<season>\\d+)x(?P<ep>\\d+)", "S${season}E${ep}", "")
+	assert.Nil(t, err)
+	val, err := formatter.Format("show 01x05", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "show S01E05", val)
+
+	formatter, err = NewReplacingFormatterWithFlags("the", "a", "i")
+	assert.Nil(t, err)
+	val, err = formatter.Format("The Show of the year", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a Show of a year", val)
+
+	formatter, err = NewReplacingFormatterWithFlags("(\\w+)\\.", "${1}_", "f")
+	assert.Nil(t, err)
+	val, err = formatter.Format("my.home.video", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "my_home.video", val)
+
+	val, err = formatter.Format("novideo", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "novideo", val)
+
+	_, err = NewReplacingFormatterWithFlags("a", "b", "g")
+	assert.NotNil(t, err)
+}
+
+func TestSliceMultiByte(t *testing.T) {
+	formatter := NewSliceFormatter(-1, 4)
+	formatted, err := formatter.Format("Crème brûlée", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Crèm", formatted)
+
+	formatted, err = formatter.Format("Cre\u0300me", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Cre\u0300m", formatted)
+
+	formatter = NewSliceFormatter(2, 5)
+	formatted, err = formatter.Format("東京都庁舎", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "都庁舎", formatted)
 }
 
 func TestValueShorterThanSlice(t *testing.T) {
@@ -1,17 +1,187 @@
 package main
 
-import "strconv"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompoundExtensions lists the extensions made of multiple parts that the $fullext intrinsic
+// recognizes when the --compound-ext flag is not set
+var DefaultCompoundExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar.lz"}
 
 // ReservedVarNames is a map with the variable name - such as $cnt - as its key and a function
-// that extracts the correct value from the renamer state as its value.
+// that extracts the correct value from the renamer state as its value. Intrinsics are only evaluated
+// when the output or a var references them, the metadata intrinsics such as $size and $mtime read the
+// file from disk the first time one of them is evaluated.
 var ReservedVarNames = map[string]func(renamerState) string{
 	"$cnt": func(rs renamerState) string {
 		return strconv.Itoa(rs.idx + 1)
 	},
+	"$total": func(rs renamerState) string {
+		return strconv.Itoa(rs.total)
+	},
 	"$ext": func(rs renamerState) string {
 		return rs.extension
 	},
 	"$fname": func(rs renamerState) string {
 		return rs.fileName
 	},
+	"$stem": func(rs renamerState) string {
+		return rs.stem
+	},
+	"$fullext": func(rs renamerState) string {
+		return rs.fullExtension
+	},
+	"$extnodot": func(rs renamerState) string {
+		return strings.TrimPrefix(rs.extension, ".")
+	},
+	"$parent": func(rs renamerState) string {
+		return filepath.Base(filepath.Dir(rs.path))
+	},
+	"$dir": func(rs renamerState) string {
+		return filepath.Dir(rs.path)
+	},
+	"$relpath": func(rs renamerState) string {
+		return rs.relPath
+	},
+	"$now": func(rs renamerState) string {
+		return formatTime(rs.now)
+	},
+	"$size": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			return strconv.FormatInt(info.Size(), 10)
+		})
+	},
+	"$hsize": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			return humanSize(info.Size())
+		})
+	},
+	"$mtime": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			return formatTime(info.ModTime())
+		})
+	},
+	"$atime": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			atime, _ := fileTimes(info)
+			return formatTime(atime)
+		})
+	},
+	"$ctime": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			_, ctime := fileTimes(info)
+			return formatTime(ctime)
+		})
+	},
+	"$mode": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			return fmt.Sprintf("%04o", info.Mode().Perm())
+		})
+	},
+	"$uid": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			uid, _, _ := fileOwner(info)
+			return uid
+		})
+	},
+	"$user": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			uid, _, _ := fileOwner(info)
+			return userName(uid)
+		})
+	},
+	"$gid": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			_, gid, _ := fileOwner(info)
+			return gid
+		})
+	},
+	"$group": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			_, gid, _ := fileOwner(info)
+			return groupName(gid)
+		})
+	},
+	"$inode": func(rs renamerState) string {
+		return rs.meta.statValue(func(info os.FileInfo) string {
+			_, _, inode := fileOwner(info)
+			return inode
+		})
+	},
+}
+
+// reservedVarNames lists the intrinsics whose names cannot be used by props, capture groups, match
+// placeholders, and vars. A user-defined variable named after any other intrinsic, such as $group or
+// $size, takes precedence over the intrinsic.
+var reservedVarNames = map[string]bool{
+	"$cnt":   true,
+	"$ext":   true,
+	"$fname": true,
+}
+
+// shadowedIntrinsics returns the names of the intrinsics replaced by a variable declared by the props
+// or the vars, sorted by name
+func shadowedIntrinsics(props []Prop, vars []Var) []string {
+	shadowed := make([]string, 0)
+	for _, name := range declaredVarNames(props, vars) {
+		if _, ok := ReservedVarNames[name]; ok && !reservedVarNames[name] {
+			shadowed = append(shadowed, name)
+		}
+	}
+	sort.Strings(shadowed)
+	return shadowed
+}
+
+// usedIntrinsics returns the names of the intrinsics referenced by the output tokens and by the
+// templates of the vars. Intrinsics shadowed by one of the props or vars are not included.
+func usedIntrinsics(tokens TokenStream, props []Prop, vars []Var) map[string]bool {
+	shadowed := make(map[string]bool)
+	for _, name := range shadowedIntrinsics(props, vars) {
+		shadowed[name] = true
+	}
+	used := make(map[string]bool)
+	streams := []TokenStream{tokens}
+	for _, v := range vars {
+		streams = append(streams, v.Tokens)
+	}
+	for _, stream := range streams {
+		for _, t := range propertyTokens(stream) {
+			if _, ok := ReservedVarNames[t.Value]; ok && !shadowed[t.Value] {
+				used[t.Value] = true
+			}
+			// counters can be grouped by an intrinsic
+			for _, o := range t.Options {
+				if _, ok := ReservedVarNames[o.Value]; ok && o.Key == "by" && !shadowed[o.Value] {
+					used[o.Value] = true
+				}
+			}
+		}
+	}
+	return used
+}
+
+// splitFileName separates a file name into its stem, its extension, and its full extension. The full
+// extension is the longest of the compound extensions the name ends with, compared case-insensitively,
+// or the extension when none of them match. The stem is the name without its full extension. Leading
+// dots are part of the stem, so dotfiles such as .bashrc have no extension.
+func splitFileName(fileName string, compound []string) (string, string, string) {
+	body := strings.TrimLeft(fileName, ".")
+	lead := fileName[:len(fileName)-len(body)]
+	if body == "" {
+		return fileName, "", ""
+	}
+
+	ext := filepath.Ext(body)
+	fullExt := ext
+	for _, c := range compound {
+		if len(c) > len(fullExt) && len(c) < len(body) && strings.HasSuffix(strings.ToLower(body), strings.ToLower(c)) {
+			fullExt = body[len(body)-len(c):]
+		}
+	}
+	return lead + body[:len(body)-len(fullExt)], ext, fullExt
 }
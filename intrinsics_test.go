@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitFileName(t *testing.T) {
+	cases := []struct {
+		name, stem, ext, fullExt string
+	}{
+		{"backup.tar.gz", "backup", ".gz", ".tar.gz"},
+		{"Backup.TAR.GZ", "Backup", ".GZ", ".TAR.GZ"},
+		{"movie.mkv", "movie", ".mkv", ".mkv"},
+		{"README", "README", "", ""},
+		{".bashrc", ".bashrc", "", ""},
+		{".bashrc.bak", ".bashrc", ".bak", ".bak"},
+		{".tar.gz", ".tar", ".gz", ".gz"},
+		{"..", "..", "", ""},
+	}
+	for _, c := range cases {
+		stem, ext, fullExt := splitFileName(c.name, DefaultCompoundExtensions)
+		assert.Equal(t, c.stem, stem, c.name)
+		assert.Equal(t, c.ext, ext, c.name)
+		assert.Equal(t, c.fullExt, fullExt, c.name)
+	}
+}
+
+func TestExtensionIntrinsics(t *testing.T) {
+	rstate := fileState("backup.tar.gz")
+	assert.Equal(t, "backup", ReservedVarNames["$stem"](rstate))
+	assert.Equal(t, ".tar.gz", ReservedVarNames["$fullext"](rstate))
+	assert.Equal(t, "gz", ReservedVarNames["$extnodot"](rstate))
+	assert.Equal(t, "backup.tar.gz", ReservedVarNames["$fname"](rstate))
+}
+
+func TestUserNamesShadowIntrinsics(t *testing.T) {
+	prop, err := ParseProp("size=(\\d+)p")
+	assert.Nil(t, err)
+	group, err := ParseMatchPattern("[{group:word}] {title}{ext}")
+	assert.Nil(t, err)
+	dir, err := ParseVar("dir=$title")
+	assert.Nil(t, err)
+	_, err = ParseProp("cnt=(\\d+)")
+	assert.NotNil(t, err)
+
+	props := []Prop{prop, group}
+	assert.Equal(t, []string{"$dir", "$group", "$size"}, shadowedIntrinsics(props, []Var{dir}))
+
+	tokens, err := ParseOutput("$group - $size - $dir - $parent$ext")
+	assert.Nil(t, err)
+	used := usedIntrinsics(tokens, props, []Var{dir})
+	assert.Equal(t, map[string]bool{"$parent": true, "$ext": true}, used)
+
+	// the file does not exist, the user-defined $size must not read its metadata
+	jobs, err := prepareRename(props, []Var{dir}, tokens, []string{"[Studio] Wedding 1080p.mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Studio", jobs[0].varValues["$group"])
+	assert.Equal(t, "1080", jobs[0].varValues["$size"])
+	assert.Equal(t, "Wedding 1080p", jobs[0].varValues["$dir"])
+}
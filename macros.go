@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// macroExpansionDepth limits how many times macros can reference other macros
+const macroExpansionDepth = 10
+
+// Macros is a map with the macro name - such as date - as its key and the regular expression it
+// expands to as its value. Macros can be used in prop matchers by wrapping their name in curly braces:
+// -p "aired=({date})". Macros are expanded in a non-capturing group, they can reference other macros,
+// and additional macros can be loaded from a file with the LoadMacros function.
+var Macros = map[string]string{
+	// 2020-11-20, 2020.11.20, 2020_11_20, or 20201120
+	"date": "(?:19|20)\\d{2}[-._]?(?:0[1-9]|1[0-2])[-._]?(?:0[1-9]|[12]\\d|3[01])",
+	// S01E05, s1e5
+	"sxxexx": "[Ss]\\d{1,2}[Ee]\\d{1,3}",
+	// 1999, 2020
+	"year": "(?:19|20)\\d{2}",
+	// an 8 characters hex hash such as ABCD1234
+	"crc": "[0-9A-Fa-f]{8}",
+	// 720p, 1080i, 1920x1080, 4K
+	"resolution": "(?:\\d{3,4}[pi]|\\d{3,4}x\\d{3,4}|[48][Kk])",
+}
+
+// LoadMacros reads macro definitions from the file at the given path and adds them to the Macros map,
+// replacing built-in macros with the same name. Each line of the file declares one macro in the
+// format "name = regex". Empty lines and lines starting with # are ignored.
+func LoadMacros(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.Index(line, "=")
+		if sep < 0 {
+			return fmt.Errorf("Invalid macro definition at %s:%d, macros must be declared as name = regex", path, lineNum)
+		}
+		name := strings.TrimSpace(line[:sep])
+		if !isMacroName(name) {
+			return fmt.Errorf("Invalid macro name %s at %s:%d, names can only contain letters and digits", name, path, lineNum)
+		}
+		Macros[name] = strings.TrimSpace(line[sep+1:])
+	}
+	return scanner.Err()
+}
+
+// ExpandMacros replaces every {name} reference to a macro in the given regular expression with the
+// expression of the macro wrapped in a non-capturing group. Escaped braces, unicode classes such as
+// \p{Greek}, and regex quantifiers such as {2,3} are left untouched. References to unknown macros return a ParseError.
+func ExpandMacros(expr string) (string, error) {
+	expanded, _, err := expandMacros(expr, 0)
+	return expanded, err
+}
+
+// macroSpan records where a macro reference was expanded. Pos is the position of the { of the
+// reference in the original expression, Start and End delimit the expansion in the expanded
+// expression. All positions are counted in runes.
+type macroSpan struct {
+	Name  string
+	Pos   int
+	Start int
+	End   int
+}
+
+// expandMacros expands the macros of the expression and returns the spans of the macro references it
+// expanded. Errors in the definition of a macro are reported at the position of its reference.
+func expandMacros(expr string, depth int) (string, []macroSpan, error) {
+	if depth > macroExpansionDepth {
+		return "", nil, fmt.Errorf("Macros are nested more than %d levels deep, check the macro definitions for cycles", macroExpansionDepth)
+	}
+	runes := []rune(expr)
+	out := ""
+	spans := make([]macroSpan, 0)
+	pos := 0
+	for pos < len(runes) {
+		chr := runes[pos]
+		if chr == '\\' && pos+1 < len(runes) {
+			end := pos + 2
+			// unicode classes such as \p{Greek} are not macros
+			if (runes[pos+1] == 'p' || runes[pos+1] == 'P') && end < len(runes) && runes[end] == '{' {
+				for end < len(runes) && runes[end] != '}' {
+					end++
+				}
+				if end < len(runes) {
+					end++
+				}
+			}
+			out += string(runes[pos:end])
+			pos = end
+			continue
+		}
+		if chr != '{' {
+			out += string(chr)
+			pos++
+			continue
+		}
+		closing := pos + 1
+		for closing < len(runes) && runes[closing] != '}' && runes[closing] != '{' {
+			closing++
+		}
+		if closing >= len(runes) || runes[closing] != '}' || !isMacroName(string(runes[pos+1:closing])) {
+			out += string(chr)
+			pos++
+			continue
+		}
+
+		name := string(runes[pos+1 : closing])
+		macro, ok := Macros[name]
+		if !ok {
+			err := newParseError(expr, pos, "Unknown macro {%s}, use \\{ for a literal curly brace", name)
+			err.Suggestion = suggestMacro(name)
+			return "", nil, err
+		}
+		expanded, _, err := expandMacros(macro, depth+1)
+		if err != nil {
+			return "", nil, macroError(expr, pos, name, err)
+		}
+		start := len([]rune(out))
+		out += "(?:" + expanded + ")"
+		spans = append(spans, macroSpan{Name: name, Pos: pos, Start: start, End: len([]rune(out))})
+		pos = closing + 1
+	}
+	return out, spans, nil
+}
+
+// macroError reports an error found in the definition of the macro name at the position of its
+// reference in the input. Errors that are not a ParseError are returned unchanged.
+func macroError(input string, pos int, name string, err error) error {
+	var macroErr *ParseError
+	if !errors.As(err, &macroErr) {
+		return err
+	}
+	parseErr := newParseError(input, pos, "Invalid macro {%s}: %s", name, macroErr.Msg)
+	parseErr.Suggestion = macroErr.Suggestion
+	return parseErr
+}
+
+// expandedPos maps a position in an expression expanded by expandMacros back to the original
+// expression. Positions inside the expansion of a macro are mapped to its reference, and the span of
+// the macro is returned so that errors can mention its name.
+func expandedPos(pos int, spans []macroSpan) (int, *macroSpan) {
+	shift := 0
+	for idx, span := range spans {
+		if pos < span.Start {
+			break
+		}
+		if pos < span.End {
+			return span.Pos, &spans[idx]
+		}
+		// the expansion replaces the reference, {name}
+		shift += (span.End - span.Start) - (len([]rune(span.Name)) + 2)
+	}
+	return pos - shift, nil
+}
+
+func suggestMacro(name string) string {
+	names := make([]string, 0, len(Macros))
+	for macro := range Macros {
+		names = append(names, macro)
+	}
+	sort.Strings(names)
+	if s := suggest(name, names); s != "" {
+		return "{" + s + "}"
+	}
+	return ""
+}
+
+// isMacroName tells whether the given string is a valid macro name: a letter followed by letters and
+// digits. Quantifiers such as {3} or {2,5} are not valid names.
+func isMacroName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for idx, chr := range name {
+		if !unicode.IsLetter(chr) && (idx == 0 || !unicode.IsDigit(chr)) {
+			return false
+		}
+	}
+	return true
+}
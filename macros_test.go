@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandMacros(t *testing.T) {
+	expanded, err := ExpandMacros("\\(({year})\\)")
+	assert.Nil(t, err)
+	assert.Equal(t, "\\(((?:"+Macros["year"]+"))\\)", expanded)
+
+	// quantifiers, escaped braces, and unicode classes are not macros
+	expanded, err = ExpandMacros("\\d{2,4}a{3}\\{year\\}\\p{Greek}")
+	assert.Nil(t, err)
+	assert.Equal(t, "\\d{2,4}a{3}\\{year\\}\\p{Greek}", expanded)
+
+	_, err = ExpandMacros("x{yaer}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 1, err.(*ParseError).Pos)
+	assert.Equal(t, "{year}", err.(*ParseError).Suggestion)
+}
+
+func TestPropWithMacros(t *testing.T) {
+	prop, err := ParseProp("ep=({sxxexx})")
+	assert.Nil(t, err)
+	assert.Equal(t, "({sxxexx})", prop.Matcher)
+	vals, err := extractVarValues(fileState("Show.S01E05.{1080p}.[ABCD1234].mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "S01E05", vals["$ep"])
+
+	prop, err = ParseProp("res=/({RESOLUTION})/i")
+	assert.NotNil(t, err)
+
+	prop, err = ParseProp("crc=\\[({crc})\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState("Show.S01E05.{1080p}.[ABCD1234].mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "ABCD1234", vals["$crc"])
+
+	_, err = ParseProp("aired=({dte})")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 7, err.(*ParseError).Pos)
+	assert.Equal(t, "{date}", err.(*ParseError).Suggestion)
+}
+
+func TestMacroErrorPositions(t *testing.T) {
+	Macros["badrepeat"] = "a**"
+	Macros["badref"] = "x{nope}"
+	defer delete(Macros, "badrepeat")
+	defer delete(Macros, "badref")
+
+	// errors in the definition of a macro point to its reference
+	_, err := ParseProp("ep=S({badrepeat})")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+	assert.Contains(t, err.(*ParseError).Msg, "{badrepeat}")
+
+	_, err = ParseProp("ep=S({badref})")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+	assert.Contains(t, err.(*ParseError).Msg, "Invalid macro {badref}: Unknown macro {nope}")
+
+	_, err = ParseMatchPattern("{show} {q:badref}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 10, err.(*ParseError).Pos)
+	assert.Contains(t, err.(*ParseError).Msg, "{badref}")
+
+	// errors after a macro point to the original matcher
+	_, err = ParseProp("ep={year}a**")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 10, err.(*ParseError).Pos)
+	assert.NotContains(t, err.(*ParseError).Msg, "macro")
+}
+
+func TestLoadMacros(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "raf_macros")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("# custom macros\n\nquality = (?:HD|SD)\nepisode = {sxxexx}\n")
+	assert.Nil(t, err)
+	file.Close()
+
+	err = LoadMacros(file.Name())
+	assert.Nil(t, err)
+	defer delete(Macros, "quality")
+	defer delete(Macros, "episode")
+
+	prop, err := ParseProp("q=({quality}) ({episode})")
+	assert.Nil(t, err)
+	vals, err := extractVarValues(fileState("Show HD S01E02.mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "S01E02", vals["$q"])
+	assert.Equal(t, "HD", vals["$q.1"])
+
+	// macros are also placeholder types in match patterns
+	prop, err = ParseMatchPattern("{show} {q:quality} {ep:episode}{ext}")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState("Show HD S01E02.mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "S01E02", vals["$ep"])
+}
+
+func TestLoadMacrosInvalid(t *testing.T) {
+	file, err := ioutil.TempFile(os.TempDir(), "raf_macros")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("quality (?:HD|SD)\n")
+	assert.Nil(t, err)
+	file.Close()
+
+	assert.NotNil(t, LoadMacros(file.Name()))
+}
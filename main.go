@@ -19,6 +19,7 @@ import (
 )
 
 const rafStatusFile = ".raf"
+const rafMacrosFile = "macros"
 const rafVersion = "v0.3.1"
 
 // TODO: this is an ugly hack for the unit tests. We should formalize this
@@ -26,10 +27,8 @@ const rafVersion = "v0.3.1"
 var writeTestRLog = false
 
 type output struct {
-	Raw            string
-	VarCount       int
-	CustomVarCount int
-	Tokens         TokenStream
+	Raw    string
+	Tokens TokenStream
 }
 
 // Opts contains the global settings for the library and it is passed to nearly
@@ -37,6 +36,22 @@ type output struct {
 type Opts struct {
 	DryRun  bool
 	Verbose bool
+	// CompoundExtensions lists the extensions made of multiple parts, such as .tar.gz, used by $fullext
+	CompoundExtensions []string
+	// Counter configures the $cnt variable, tokens can override it with their own options
+	Counter CounterOptions
+	// Sort is the order in which files are assigned a counter, see ValidateSort
+	Sort string
+	// Reverse inverts the sort order
+	Reverse bool
+	// ASCII transliterates the generated names to ASCII
+	ASCII bool
+	// Normalize is the Unicode normalization form of the generated names, see ValidateNormalize
+	Normalize string
+	// CaseInsensitive detects collisions between names that only differ in case
+	CaseInsensitive bool
+	// Sanitize is the platform the generated names are made valid for, see ValidateSanitize
+	Sanitize string
 }
 
 func main() {
@@ -58,29 +73,11 @@ func getApp() *cli.App {
 		Usage:       "raf -p \"title=Video\\ \\d+\\ \\-\\ ([A-Za-z0-9\\ ]+)_\" -d -o 'UnionStudio - $cnt - $title.mkv' *",
 		Description: cliDescription,
 		Version:     rafVersion,
-		Flags: []cli.Flag{
-			&cli.StringSliceFlag{
-				Name:    "prop",
-				Aliases: []string{"p"},
-				//Usage:   "-p \"title=Video\\ \\d+\\ \\-\\ ([A-Za-z0-9\\ ]+)_\"",
-				Usage: propFlagDescription,
-			},
-			&cli.StringFlag{
-				Name:    "output",
-				Aliases: []string{"o"},
-				Usage:   outputFlagDescription,
-			},
-			&cli.BoolFlag{
-				Name:    "dryrun",
-				Aliases: []string{"d"},
-				Usage:   dryRunFlagDescription,
-			},
-			&cli.BoolFlag{
-				Name:    "verbose",
-				Aliases: []string{"v"},
-				Usage:   "Prints verbose output",
-			},
-		},
+		Flags: append(append(renameFlags(), dryRunFlags()...), &cli.BoolFlag{
+			Name:    "verbose",
+			Aliases: []string{"v"},
+			Usage:   "Prints verbose output",
+		}),
 		Action: rename,
 		Commands: []*cli.Command{
 			{
@@ -88,6 +85,41 @@ func getApp() *cli.App {
 				Usage:  undoCommandDescription,
 				Action: undo,
 			},
+			{
+				Name:   "explain",
+				Usage:  explainCommandDescription,
+				Flags:  renameFlags(),
+				Action: explain,
+			},
+			{
+				Name:  "reseq",
+				Usage: reseqCommandDescription,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "prop",
+						Aliases: []string{"p"},
+						Usage:   reseqPropFlagDescription,
+					},
+					&cli.StringFlag{
+						Name:  "macros",
+						Usage: macrosFlagDescription,
+					},
+					&cli.IntFlag{
+						Name:  "start",
+						Value: 1,
+						Usage: "First number of the new sequence",
+					},
+					&cli.IntFlag{
+						Name:  "offset",
+						Usage: "Shifts the existing numbers by the given offset instead of renumbering them",
+					},
+					&cli.IntFlag{
+						Name:  "width",
+						Usage: "Zero-pads the numbers to the given number of digits, defaults to the width of the existing numbers",
+					},
+				}, dryRunFlags()...),
+				Action: reseq,
+			},
 			{
 				Name:   "man",
 				Usage:  "Show man page for raf",
@@ -97,9 +129,100 @@ func getApp() *cli.App {
 	}
 }
 
+// renameFlags returns the flags that define how the new names are generated. They are shared by the
+// rename action and the explain command.
+func renameFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "prop",
+			Aliases: []string{"p"},
+			Usage:   propFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:    "match",
+			Aliases: []string{"m"},
+			Usage:   matchFlagDescription,
+		},
+		&cli.StringSliceFlag{
+			Name:  "var",
+			Usage: varFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   outputFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "macros",
+			Usage: macrosFlagDescription,
+		},
+		&cli.StringSliceFlag{
+			Name:  "compound-ext",
+			Value: cli.NewStringSlice(DefaultCompoundExtensions...),
+			Usage: compoundExtFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "cnt",
+			Usage: cntFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Value: SortNone,
+			Usage: sortFlagDescription,
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: reverseFlagDescription,
+		},
+		&cli.BoolFlag{
+			Name:  "ascii",
+			Usage: asciiFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "normalize",
+			Value: NormalizeNone,
+			Usage: normalizeFlagDescription,
+		},
+		&cli.BoolFlag{
+			Name:  "case-insensitive",
+			Usage: caseInsensitiveFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "sanitize",
+			Value: SanitizeNone,
+			Usage: sanitizeFlagDescription,
+		},
+	}
+}
+
+// dryRunFlags returns the flags that control the dry run mode and its output. They are shared by the
+// rename action and the reseq command.
+func dryRunFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "dryrun",
+			Aliases: []string{"d"},
+			Usage:   dryRunFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "view",
+			Value: DryRunViewList,
+			Usage: viewFlagDescription,
+		},
+		&cli.StringFlag{
+			Name:  "color",
+			Value: ColorModeAuto,
+			Usage: colorFlagDescription,
+		},
+	}
+}
+
 func undo(c *cli.Context) error {
 	path := c.Args().First()
-	opts := readOpts(c)
+	opts, err := readOpts(c)
+	if err != nil {
+		return err
+	}
 	rlog, err := Undo(path, opts)
 	if err != nil {
 		return err
@@ -108,7 +231,35 @@ func undo(c *cli.Context) error {
 
 }
 
+func explain(c *cli.Context) error {
+	matches, err := validateMatcher(c)
+	if err != nil {
+		return err
+	}
+	props, err := validateProps(c)
+	if err != nil {
+		return err
+	}
+	vars, err := validateVars(c, props)
+	if err != nil {
+		return err
+	}
+	out, err := validateOutput(c, props, vars)
+	if err != nil {
+		return err
+	}
+	opts, err := readOpts(c)
+	if err != nil {
+		return err
+	}
+	return Explain(props, vars, out.Tokens, matches, opts, os.Stdout)
+}
+
 func rename(c *cli.Context) error {
+	err := configureColor(c.String("color"))
+	if err != nil {
+		return err
+	}
 	matches, err := validateMatcher(c)
 	if err != nil {
 		return err
@@ -117,15 +268,19 @@ func rename(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	out, err := validateOutput(c)
+	vars, err := validateVars(c, props)
+	if err != nil {
+		return err
+	}
+	out, err := validateOutput(c, props, vars)
 	if err != nil {
 		return err
 	}
-	if len(props) < out.CustomVarCount {
-		return fmt.Errorf("The command declared %d properties but uses %d in the output formatter\n", len(props), out.CustomVarCount)
+	opts, err := readOpts(c)
+	if err != nil {
+		return err
 	}
-	opts := readOpts(c)
-	rlog, err := RenameAllFiles(props, out.Tokens, matches, opts)
+	rlog, err := RenameAllFiles(props, vars, out.Tokens, matches, opts)
 	if err != nil {
 		return err
 	}
@@ -134,37 +289,9 @@ func rename(c *cli.Context) error {
 		return Apply(rlog, path, opts)
 	}
 	if opts.DryRun {
-		for _, e := range rlog {
-			dryRunPrint(e.OriginalFileName, e.NewFileName)
-		}
-		fmt.Fprintln(os.Stderr)
-
-		// print out warnings
-		yellow := color.New(color.FgYellow).SprintFunc()
-		for _, e := range rlog {
-			if e.Warnings != nil && len(e.Warnings) > 0 {
-				for _, w := range e.Warnings {
-					fmt.Fprintln(os.Stderr, yellow(w.String(e)))
-				}
-			}
-		}
-		// print out collisions
-		printed := make([]bool, len(rlog))
-		red := color.New(color.FgHiRed).SprintFunc()
-		for logidx, e := range rlog {
-			if e.Collisions != nil && !printed[logidx] && len(e.Collisions) > 0 {
-				collisionLog := fmt.Sprintf("[ERROR] File \"%s\" would be renamed to \"%s\" and would collide with: ", e.OriginalFileName, e.NewFileName)
-				otherNames := make([]string, len(e.Collisions)-1) // -1 because it always includes itself
-				for cidx, c := range e.Collisions {
-					if c != logidx {
-						otherNames[cidx-1] = rlog[c].OriginalFileName
-						printed[c] = true
-					}
-				}
-				collisionLog += strings.Join(otherNames, ", ")
-				fmt.Fprintln(os.Stderr, red(collisionLog))
-				printed[logidx] = true
-			}
+		err = printDryRun(c, rlog)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -178,6 +305,93 @@ func rename(c *cli.Context) error {
 	return nil
 }
 
+func reseq(c *cli.Context) error {
+	err := configureColor(c.String("color"))
+	if err != nil {
+		return err
+	}
+	matches, err := validateMatcher(c)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("start") && c.IsSet("offset") {
+		return errors.New("The start and offset options cannot be used together")
+	}
+	if c.Int("width") < 0 {
+		return errors.New("The width must be a positive number")
+	}
+	if err := loadMacros(c); err != nil {
+		return err
+	}
+	prop, err := NewReseqProp(c.String("prop"))
+	if err != nil {
+		return err
+	}
+	rlog, missing, err := Resequence(prop, matches, ReseqOpts{
+		Start:     c.Int("start"),
+		Offset:    c.Int("offset"),
+		HasOffset: c.IsSet("offset"),
+		Width:     c.Int("width"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Missing numbers: %s\n", formatRanges(missing))
+	}
+
+	opts := Opts{DryRun: c.Bool("dryrun")}
+	if !opts.DryRun {
+		for _, e := range rlog {
+			if len(e.Collisions) > 0 {
+				return fmt.Errorf("Could not resequence the files, %s would collide with another file", e.NewFileName)
+			}
+		}
+		return Apply(rlog, filepath.Dir(matches[0]), opts)
+	}
+	return printDryRun(c, rlog)
+}
+
+// printDryRun prints the changes in the rename log with the view selected by the --view flag, followed
+// by the warnings and the collisions
+func printDryRun(c *cli.Context, rlog RenameLog) error {
+	printer, err := newDryRunPrinter(c.String("view"), terminalWidth(), os.Stdout)
+	if err != nil {
+		return err
+	}
+	printer.Print(rlog)
+	fmt.Fprintln(os.Stderr)
+
+	// print out warnings
+	yellow := color.New(color.FgYellow).SprintFunc()
+	for _, e := range rlog {
+		if e.Warnings != nil && len(e.Warnings) > 0 {
+			for _, w := range e.Warnings {
+				fmt.Fprintln(os.Stderr, yellow(w.String(e)))
+			}
+		}
+	}
+	// print out collisions
+	printed := make([]bool, len(rlog))
+	red := color.New(color.FgHiRed).SprintFunc()
+	for logidx, e := range rlog {
+		if e.Collisions != nil && !printed[logidx] && len(e.Collisions) > 0 {
+			collisionLog := fmt.Sprintf("[ERROR] File \"%s\" would be renamed to \"%s\" and would collide with: ", e.OriginalFileName, e.NewFileName)
+			otherNames := make([]string, len(e.Collisions)-1) // -1 because it always includes itself
+			for cidx, c := range e.Collisions {
+				if c != logidx {
+					otherNames[cidx-1] = rlog[c].OriginalFileName
+					printed[c] = true
+				}
+			}
+			collisionLog += strings.Join(otherNames, ", ")
+			fmt.Fprintln(os.Stderr, red(collisionLog))
+			printed[logidx] = true
+		}
+	}
+	return nil
+}
+
 func man(c *cli.Context) error {
 	manUri := "https://raw.githubusercontent.com/sapessi/raf/" + rafVersion + "/raf.1"
 	manWebMessage := fmt.Sprintf("The latest version of the documentation is available in the man page at %s", manUri)
@@ -245,11 +459,42 @@ func getManPage(rafUri, rafHome, version string) (string, error) {
 	return rafManPath, nil
 }
 
-func readOpts(c *cli.Context) Opts {
-	return Opts{
-		DryRun:  c.Bool("dryrun"),
-		Verbose: c.Bool("verbose"),
+func readOpts(c *cli.Context) (Opts, error) {
+	compound := make([]string, 0)
+	for _, ext := range c.StringSlice("compound-ext") {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		compound = append(compound, ext)
+	}
+	counter, err := ParseCounterFlag(c.String("cnt"))
+	if err != nil {
+		return Opts{}, err
+	}
+	sortKey, err := ValidateSort(c.String("sort"))
+	if err != nil {
+		return Opts{}, err
+	}
+	normalize, err := ValidateNormalize(c.String("normalize"))
+	if err != nil {
+		return Opts{}, err
 	}
+	sanitize, err := ValidateSanitize(c.String("sanitize"))
+	if err != nil {
+		return Opts{}, err
+	}
+	return Opts{
+		DryRun:             c.Bool("dryrun"),
+		Verbose:            c.Bool("verbose"),
+		CompoundExtensions: compound,
+		Counter:            counter,
+		Sort:               sortKey,
+		Reverse:            c.Bool("reverse"),
+		ASCII:              c.Bool("ascii"),
+		Normalize:          normalize,
+		CaseInsensitive:    c.Bool("case-insensitive"),
+		Sanitize:           sanitize,
+	}, nil
 }
 
 func validateMatcher(c *cli.Context) ([]string, error) {
@@ -281,6 +526,11 @@ func validateMatcher(c *cli.Context) ([]string, error) {
 }
 
 func validateProps(c *cli.Context) ([]Prop, error) {
+	err := loadMacros(c)
+	if err != nil {
+		return nil, err
+	}
+
 	args := c.StringSlice("prop")
 	props := make([]Prop, len(args))
 
@@ -292,10 +542,69 @@ func validateProps(c *cli.Context) ([]Prop, error) {
 		props[idx] = prop
 	}
 
+	if pattern := c.String("match"); pattern != "" {
+		prop, err := ParseMatchPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+
 	return props, nil
 }
 
-func validateOutput(c *cli.Context) (*output, error) {
+// loadMacros reads the macros file passed with the --macros flag. If the flag is not set, raf looks for
+// a macros file in its home directory (~/.raf/macros) and silently ignores it if it does not exist.
+func loadMacros(c *cli.Context) error {
+	path := c.String("macros")
+	if path != "" {
+		return LoadMacros(path)
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return nil
+	}
+	path = usr.HomeDir + string(os.PathSeparator) + ".raf" + string(os.PathSeparator) + rafMacrosFile
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return LoadMacros(path)
+}
+
+func validateVars(c *cli.Context, props []Prop) ([]Var, error) {
+	args := c.StringSlice("var")
+	vars := make([]Var, len(args))
+	for idx, v := range args {
+		parsed, err := ParseVar(v)
+		if err != nil {
+			return nil, err
+		}
+		vars[idx] = parsed
+	}
+	if err := ValidateVarNames(vars, props); err != nil {
+		return nil, err
+	}
+	yellow := color.New(color.FgYellow).SprintFunc()
+	for _, name := range shadowedIntrinsics(props, vars) {
+		fmt.Fprintln(os.Stderr, yellow(fmt.Sprintf("WARNING: %s is declared by a property or variable and replaces the intrinsic variable with the same name", name)))
+	}
+
+	declared := declaredVarNames(props, vars)
+	for idx, v := range vars {
+		vars[idx].Tokens = ResolveGroupReferences(v.Tokens, declared)
+		err := ValidateOutputVars(v.Template, vars[idx].Tokens, declared)
+		if err != nil {
+			return nil, shiftParseError(err, args[idx], len([]rune(v.Name))+1)
+		}
+	}
+	_, err := SortVars(vars)
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func validateOutput(c *cli.Context, props []Prop, vars []Var) (*output, error) {
 	rawOutput := c.String("output")
 	if rawOutput == "" {
 		return nil, errors.New("Output formatter must be a valid string and cannot be empty")
@@ -305,29 +614,15 @@ func validateOutput(c *cli.Context) (*output, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	varCount := 0
-	customVarCount := 0
-	for _, t := range tokens {
-		if t.Type != TokenTypeProperty {
-			continue
-		}
-		varCount++
-		if _, ok := ReservedVarNames[t.Value]; !ok {
-			customVarCount++
-		}
+	declared := declaredVarNames(props, vars)
+	tokens = ResolveGroupReferences(tokens, declared)
+	err = ValidateOutputVars(rawOutput, tokens, declared)
+	if err != nil {
+		return nil, err
 	}
 
 	return &output{
-		Raw:            rawOutput,
-		VarCount:       varCount,
-		CustomVarCount: customVarCount,
-		Tokens:         tokens,
+		Raw:    rawOutput,
+		Tokens: tokens,
 	}, nil
 }
-
-func dryRunPrint(from, to string) {
-	red := color.New(color.FgHiRed).SprintFunc()
-	green := color.New(color.FgGreen).SprintFunc()
-	fmt.Printf("File %s -> %s\n", red(from), green(to))
-}
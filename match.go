@@ -0,0 +1,115 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// matchPropName is the name of the prop generated from the --match pattern
+const matchPropName = "match"
+
+// matchPlaceholderTypes maps the type of a placeholder in a match pattern to the regular expression
+// used to capture its value
+var matchPlaceholderTypes = map[string]string{
+	"str":  ".+?",
+	"int":  "\\d+",
+	"word": "\\w+",
+}
+
+// ParseMatchPattern compiles a reverse template such as "{show}.S{season:int}E{ep:int}{ext}" into a Prop.
+// Placeholders in curly braces capture a value and make it available as a variable with the same name:
+// $show, $season, and $ep. A placeholder can declare its type after a colon: str (default) matches any
+// text, int matches digits, word matches letters, digits, and underscores, and the name of one of the
+// Macros uses its regular expression - {aired:date}. The {ext} placeholder
+// matches the extension of the file, and an unnamed placeholder {} matches any text without storing it.
+// Everything outside of placeholders must match literally, use \{ for a literal curly brace.
+//
+// The pattern must match the entire file name. The generated prop is required with the skip mode,
+// files whose name does not match the pattern are not renamed.
+func ParseMatchPattern(pattern string) (Prop, error) {
+	runes := []rune(pattern)
+	names := make(map[string]bool)
+	expr := "^"
+	pos := 0
+	for pos < len(runes) {
+		chr := runes[pos]
+		if chr == '\\' && pos+1 < len(runes) {
+			expr += regexp.QuoteMeta(string(runes[pos+1]))
+			pos += 2
+			continue
+		}
+		if chr != '{' {
+			expr += regexp.QuoteMeta(string(chr))
+			pos++
+			continue
+		}
+
+		closing := pos + 1
+		for closing < len(runes) && runes[closing] != '}' {
+			closing++
+		}
+		if closing >= len(runes) {
+			return Prop{}, newParseError(pattern, pos, "Unclosed { in match pattern")
+		}
+		name, placeholder, err := placeholderRegex(pattern, pos+1, string(runes[pos+1:closing]))
+		if err != nil {
+			return Prop{}, err
+		}
+		if name != "" && names[name] {
+			return Prop{}, newParseError(pattern, pos+1, "The placeholder %s is declared more than once", name)
+		}
+		names[name] = true
+		expr += placeholder
+		pos = closing + 1
+	}
+	expr += "$"
+
+	prop, err := NewProp(matchPropName, expr)
+	if err != nil {
+		return Prop{}, newParseError(pattern, 0, "%s", err)
+	}
+	prop.Matcher = pattern
+	prop.Required = PropRequiredSkip
+	return prop, nil
+}
+
+// placeholderRegex returns the name of the variable captured by a single placeholder and its regular
+// expression. The pos parameter is the position of the placeholder content in the pattern and it is
+// used to report errors. Placeholders that do not capture a variable return an empty name.
+func placeholderRegex(pattern string, pos int, placeholder string) (string, string, error) {
+	name := placeholder
+	typeName := "str"
+	if sep := strings.Index(placeholder, ":"); sep >= 0 {
+		name = placeholder[:sep]
+		typeName = placeholder[sep+1:]
+	}
+	typeRegex, ok := matchPlaceholderTypes[typeName]
+	if !ok {
+		macro, isMacro := Macros[typeName]
+		if !isMacro {
+			return "", "", newParseError(pattern, pos+len([]rune(name))+1, "Unknown placeholder type %s, supported types are str, int, word, and the name of a macro", typeName)
+		}
+		expanded, err := ExpandMacros(macro)
+		if err != nil {
+			return "", "", macroError(pattern, pos+len([]rune(name))+1, typeName, err)
+		}
+		typeRegex = "(?:" + expanded + ")"
+	}
+
+	if name == "" {
+		return "", "(?:" + typeRegex + ")", nil
+	}
+	if name == "ext" {
+		return "", "(?:\\.[^.]+)", nil
+	}
+	for idx, chr := range []rune(name) {
+		if !unicode.IsLetter(chr) && !unicode.IsDigit(chr) {
+			return "", "", newParseError(pattern, pos+idx, "Invalid character %s in placeholder name, names can only contain letters and digits", string(chr))
+		}
+	}
+	if reservedVarNames["$"+name] {
+		return "", "", newParseError(pattern, pos, "The placeholder name %s is reserved", name)
+	}
+	return name, "(?P<" + name + ">" + typeRegex + ")", nil
+}
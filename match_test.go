@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatchPattern(t *testing.T) {
+	prop, err := ParseMatchPattern("{show}.S{season:int}E{ep:int}.{quality}{ext}")
+	assert.Nil(t, err)
+	assert.Equal(t, PropRequiredSkip, prop.Required)
+
+	vals, err := extractVarValues(fileState("The.Show.S01E05.720p.mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "The.Show", vals["$show"])
+	assert.Equal(t, "01", vals["$season"])
+	assert.Equal(t, "05", vals["$ep"])
+	assert.Equal(t, "720p", vals["$quality"])
+
+	_, err = extractVarValues(fileState("The.Show.S01.720p.mkv"), []Prop{prop}, Opts{})
+	assert.IsType(t, &PropNotMatchedError{}, err)
+}
+
+func TestParseMatchPatternLiterals(t *testing.T) {
+	prop, err := ParseMatchPattern("[{group:word}] {title} \\{{} (*){ext}")
+	assert.Nil(t, err)
+
+	vals, err := extractVarValues(fileState("[Studio] Wedding Video {x} (*).mkv"), []Prop{prop}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Studio", vals["$group"])
+	assert.Equal(t, "Wedding Video", vals["$title"])
+}
+
+func TestParseMatchPatternErrors(t *testing.T) {
+	_, err := ParseMatchPattern("{show}.S{season:number}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 16, err.(*ParseError).Pos)
+
+	_, err = ParseMatchPattern("{show}.S{season")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Unclosed { in match pattern", err.(*ParseError).Msg)
+
+	_, err = ParseMatchPattern("{show} {show}")
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseMatchPattern("{cnt} - {title}")
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseMatchPattern("{my_show}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 3, err.(*ParseError).Pos)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NormalizeNone leaves the generated names as they are
+	NormalizeNone = "none"
+	// NormalizeNFC composes the generated names, the form most Linux and Windows tools produce
+	NormalizeNFC = "nfc"
+	// NormalizeNFD decomposes the generated names, the form used by file names copied from macOS
+	NormalizeNFD = "nfd"
+)
+
+// ValidateNormalize checks the value of the --normalize flag and returns the normalization form
+func ValidateNormalize(v string) (string, error) {
+	switch v {
+	case "":
+		return NormalizeNone, nil
+	case NormalizeNone, NormalizeNFC, NormalizeNFD:
+		return v, nil
+	}
+	err := newParseError(v, 0, "Unknown normalization form %s, supported forms are nfc, nfd, and none", v)
+	err.Suggestion = suggest(v, []string{NormalizeNFC, NormalizeNFD, NormalizeNone})
+	return "", err
+}
+
+// normalizeName converts the name to the given normalization form
+func normalizeName(name, form string) string {
+	switch form {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	}
+	return name
+}
+
+// collisionKey returns the form of a name used to detect collisions. Names that only differ in their
+// normalization form, such as an NFD name copied from macOS and the same name typed on Linux, share the
+// same key. With foldCase names that only differ in case also share the key, as they would on a
+// case-insensitive file system.
+func collisionKey(name string, foldCase bool) string {
+	key := norm.NFC.String(name)
+	if foldCase {
+		key = cases.Fold().String(key)
+	}
+	return key
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	nfcName = "Caf\u00e9.mkv"
+	nfdName = "Cafe\u0301.mkv"
+)
+
+func TestValidateNormalize(t *testing.T) {
+	form, err := ValidateNormalize("")
+	assert.Nil(t, err)
+	assert.Equal(t, NormalizeNone, form)
+
+	form, err = ValidateNormalize("nfd")
+	assert.Nil(t, err)
+	assert.Equal(t, NormalizeNFD, form)
+
+	_, err = ValidateNormalize("nfkc")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "nfc", err.(*ParseError).Suggestion)
+}
+
+func TestNormalizeGeneratedName(t *testing.T) {
+	tokens, err := ParseOutput("$title.mkv")
+	assert.Nil(t, err)
+	vals := VarValues{"$title": "Cafe\u0301"}
+
+	name, _, err := GenerateName(vals, tokens, renamerState{}, Opts{Normalize: NormalizeNFC})
+	assert.Nil(t, err)
+	assert.Equal(t, nfcName, name)
+
+	name, _, err = GenerateName(VarValues{"$title": "Caf\u00e9"}, tokens, renamerState{}, Opts{Normalize: NormalizeNFD})
+	assert.Nil(t, err)
+	assert.Equal(t, nfdName, name)
+
+	name, _, err = GenerateName(vals, tokens, renamerState{}, Opts{Normalize: NormalizeNone})
+	assert.Nil(t, err)
+	assert.Equal(t, nfdName, name)
+}
+
+func TestNormalizedCollisions(t *testing.T) {
+	rlog := RenameLog{
+		{OriginalFileName: "a.mkv", NewFileName: nfcName},
+		{OriginalFileName: "b.mkv", NewFileName: nfdName},
+		{OriginalFileName: "c.mkv", NewFileName: "CAF\u00c9.mkv"},
+	}
+	markCollisions(rlog, false)
+	assert.Equal(t, []int{0, 1}, rlog[0].Collisions)
+	assert.Equal(t, []int{0, 1}, rlog[1].Collisions)
+	assert.Nil(t, rlog[2].Collisions)
+
+	markCollisions(rlog, true)
+	assert.Equal(t, []int{0, 1, 2}, rlog[2].Collisions)
+}
+
+func TestNormalizedOverlap(t *testing.T) {
+	rlog := RenameLog{
+		{OriginalFileName: nfdName, NewFileName: nfcName},
+	}
+	assert.False(t, renamesOverlap(rlog))
+
+	rlog = RenameLog{
+		{OriginalFileName: nfdName, NewFileName: "b.mkv"},
+		{OriginalFileName: "a.mkv", NewFileName: nfcName},
+	}
+	assert.True(t, renamesOverlap(rlog))
+}
@@ -0,0 +1,72 @@
+package main
+
+import "strings"
+
+// option is a single key=value pair declared in an option list such as {match=all,sep=+}. Options
+// without a value, for example {required}, have an empty Value.
+type option struct {
+	Key   string
+	Value string
+	// Pos is the position of the option key in the input string, counted in runes
+	Pos int
+}
+
+// parseOptionList parses a comma separated list of options enclosed in curly braces starting at the
+// given position of the input. The character at pos must be the opening {. Commas, braces, and
+// backslashes in values can be escaped with a backslash. The function returns the options and the
+// position of the first character after the closing }.
+func parseOptionList(input string, pos int) ([]option, int, error) {
+	runes := []rune(input)
+	openPos := pos
+	pos++ // skip the {
+
+	options := make([]option, 0)
+	cur := option{Pos: pos}
+	buf := ""
+	inValue := false
+	flush := func() *ParseError {
+		if inValue {
+			cur.Value = buf
+		} else {
+			cur.Key = strings.TrimSpace(buf)
+		}
+		if cur.Key == "" {
+			return newParseError(input, cur.Pos, "Missing option name")
+		}
+		options = append(options, cur)
+		return nil
+	}
+
+	for pos < len(runes) {
+		chr := runes[pos]
+		switch {
+		case chr == '\\' && pos+1 < len(runes):
+			buf += string(runes[pos+1])
+			pos += 2
+			continue
+		case chr == '=' && !inValue:
+			cur.Key = strings.TrimSpace(buf)
+			buf = ""
+			inValue = true
+		case chr == ',':
+			if err := flush(); err != nil {
+				return nil, pos, err
+			}
+			cur = option{Pos: pos + 1}
+			buf = ""
+			inValue = false
+		case chr == '}':
+			if len(options) == 0 && !inValue && strings.TrimSpace(buf) == "" {
+				return options, pos + 1, nil // empty list
+			}
+			if err := flush(); err != nil {
+				return nil, pos, err
+			}
+			return options, pos + 1, nil
+		default:
+			buf += string(chr)
+		}
+		pos++
+	}
+	return nil, pos, newParseError(input, openPos, "Unclosed { in option list")
+}
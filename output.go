@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 	"unicode"
 )
 
@@ -11,6 +11,9 @@ const (
 	TokenTypeLiteral = "literal"
 	// TokenTypeProperty is used for variables to be replaced in the output
 	TokenTypeProperty = "property"
+	// TokenTypeGroup is used for ${...} segments that choose between alternatives or fall back to a
+	// default value
+	TokenTypeGroup = "group"
 )
 
 // TokenStream is a slice of tokens produced by parsing an output string
@@ -29,6 +32,17 @@ type Token struct {
 	Type      TokenType
 	Value     string
 	Formatter FormattingPipeline
+	// Pos is the position of the first character of the token in the output definition, counted in runes
+	Pos int
+	// Options are declared in curly braces after the name of the property. Only the $cnt variable
+	// accepts options: $cnt{start=101,by=$season}
+	Options []option
+	// Alternatives are the token streams of a group token separated by |. The group renders the first
+	// alternative whose properties all have a value: ${title|fname}, ${ - $subtitle}
+	Alternatives []TokenStream
+	// Fallback is rendered when none of the alternatives of a group token has a value: ${title:-Untitled}.
+	// It is nil when the group does not declare a fallback.
+	Fallback TokenStream
 }
 
 // FormattingPipeline is a slice of formatters associated with a property. Formatters are executed in
@@ -49,6 +63,7 @@ type statefulParser struct {
 	idx      int
 	len      int
 	str      []rune
+	raw      string
 	curValue string
 }
 
@@ -57,17 +72,29 @@ func newParser(out string) statefulParser {
 	return statefulParser{
 		idx: 0,
 		str: runeSlice,
+		raw: out,
 		len: len(runeSlice),
 	}
 }
 
+// errorAt returns a ParseError pointing at the given position of the output definition
+func (p *statefulParser) errorAt(pos int, format string, args ...interface{}) *ParseError {
+	return newParseError(p.raw, pos, format, args...)
+}
+
 func (p *statefulParser) parse() (TokenStream, error) {
 	if p.len == 0 {
 		return nil, nil
 	}
 	tokens := make([]Token, 0)
 	for !p.isLast() {
-		if p.peek() == '$' {
+		if p.peek() == '$' && p.idx+1 < p.len && p.str[p.idx+1] == '{' {
+			group, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, group)
+		} else if p.peek() == '$' {
 			prop, err := p.parseProperty()
 			if err != nil {
 				return nil, err
@@ -110,6 +137,7 @@ func (p *statefulParser) isLast() bool {
 }
 
 func (p *statefulParser) parseProperty() (Token, error) {
+	start := p.idx
 	prop := ""
 	for !p.isLast() {
 		prop += string(p.nextChr())
@@ -117,6 +145,32 @@ func (p *statefulParser) parseProperty() (Token, error) {
 			break
 		}
 	}
+	if prop == "$" {
+		return Token{}, p.errorAt(start, "Missing variable name after $, use \\$ for a literal $")
+	}
+	// numbered capture group: $name.1
+	if p.peek() == '.' && p.idx+1 < p.len && unicode.IsDigit(p.str[p.idx+1]) {
+		prop += string(p.nextChr())
+		for !p.isLast() && unicode.IsDigit(p.peek()) {
+			prop += string(p.nextChr())
+		}
+	}
+
+	// counter options
+	var options []option
+	if prop == counterVarName && !p.isLast() && p.peek() == '{' {
+		var err error
+		options, p.idx, err = parseOptionList(p.raw, p.idx)
+		if err != nil {
+			return Token{}, err
+		}
+		if _, err := ParseCounterOptions(p.raw, CounterOptions{}, options); err != nil {
+			return Token{}, err
+		}
+		if len(options) == 0 {
+			options = nil
+		}
+	}
 
 	// next we have a formatter
 	if p.peek() == '[' {
@@ -131,6 +185,8 @@ func (p *statefulParser) parseProperty() (Token, error) {
 			Type:      TokenTypeProperty,
 			Value:     prop,
 			Formatter: formatters,
+			Pos:       start,
+			Options:   options,
 		}, nil
 	}
 
@@ -138,21 +194,154 @@ func (p *statefulParser) parseProperty() (Token, error) {
 		Type:      TokenTypeProperty,
 		Value:     prop,
 		Formatter: nil,
+		Pos:       start,
+		Options:   options,
 	}, nil
 }
 
+// parseGroup parses a ${...} segment. The segment contains alternatives separated by | and, optionally,
+// a fallback after :- . Alternatives that start with a letter are the name of a variable, other
+// alternatives are templates with the same syntax as the output: ${title|fname:-Untitled}, ${ - $subtitle}.
+// Brackets and braces in the segment must be balanced, use \| and \} for literal characters.
+func (p *statefulParser) parseGroup() (Token, error) {
+	start := p.idx
+	p.idx += 2 // skip the ${
+
+	alternatives := make([]TokenStream, 0)
+	var fallback TokenStream
+	inFallback := false
+	segStart := p.idx
+	depth := 0
+	for {
+		if p.isLast() {
+			return Token{}, p.errorAt(start, "Unclosed ${ in output, the format is ${name|name:-default}")
+		}
+		chr := p.peek()
+		if chr == '\\' && p.idx+1 < p.len {
+			p.idx += 2
+			continue
+		}
+		switch {
+		case chr == '[' || chr == '{':
+			depth++
+		case (chr == ']' || chr == '}') && depth > 0:
+			depth--
+		case depth == 0 && (chr == '}' || chr == '|' && !inFallback || chr == ':' && !inFallback && p.idx+1 < p.len && p.str[p.idx+1] == '-'):
+			segment, err := p.parseGroupSegment(segStart, p.idx, !inFallback)
+			if err != nil {
+				return Token{}, err
+			}
+			if inFallback {
+				fallback = segment
+			} else {
+				alternatives = append(alternatives, segment)
+			}
+			p.nextChr()
+			if chr == '}' {
+				token := Token{
+					Type:         TokenTypeGroup,
+					Value:        string(p.str[start:p.idx]),
+					Pos:          start,
+					Alternatives: alternatives,
+					Fallback:     fallback,
+				}
+				if p.peek() == '[' {
+					formatters, err := p.parseFormatters()
+					if err != nil {
+						return Token{}, err
+					}
+					p.nextChr() // skip the closing ]
+					token.Formatter = formatters
+				}
+				return token, nil
+			}
+			if chr == ':' {
+				p.nextChr() // skip the -
+				inFallback = true
+			}
+			segStart = p.idx
+			continue
+		}
+		p.nextChr()
+	}
+}
+
+// parseGroupSegment parses the text of a group between the given positions. Alternatives that start
+// with a letter are the name of a variable.
+func (p *statefulParser) parseGroupSegment(from, to int, alternative bool) (TokenStream, error) {
+	text := string(p.str[from:to])
+	offset := from
+	if alternative {
+		if text == "" {
+			return nil, p.errorAt(from, "Missing alternative in ${...}")
+		}
+		if unicode.IsLetter(p.str[from]) {
+			text = "$" + text
+			offset--
+		}
+	}
+	tokens, err := ParseOutput(text)
+	if err != nil {
+		return nil, shiftParseError(err, p.raw, offset)
+	}
+	if tokens == nil {
+		tokens = make(TokenStream, 0)
+	}
+	shiftTokens(tokens, offset)
+	if offset < from && len(tokens) > 0 {
+		// point at the name of the variable rather than at the character before it
+		tokens[0].Pos = from
+	}
+	return tokens, nil
+}
+
+// shiftTokens moves the position of the tokens, and of the tokens nested in groups, by the given offset
+func shiftTokens(tokens TokenStream, offset int) {
+	for idx := range tokens {
+		tokens[idx].Pos += offset
+		for oidx := range tokens[idx].Options {
+			tokens[idx].Options[oidx].Pos += offset
+		}
+		for _, alt := range tokens[idx].Alternatives {
+			shiftTokens(alt, offset)
+		}
+		shiftTokens(tokens[idx].Fallback, offset)
+	}
+}
+
+// propertyTokens returns the property tokens of the stream, including the ones nested in groups
+func propertyTokens(tokens TokenStream) []Token {
+	props := make([]Token, 0)
+	for _, t := range tokens {
+		switch t.Type {
+		case TokenTypeProperty:
+			props = append(props, t)
+		case TokenTypeGroup:
+			for _, alt := range t.Alternatives {
+				props = append(props, propertyTokens(alt)...)
+			}
+			props = append(props, propertyTokens(t.Fallback)...)
+		}
+	}
+	return props
+}
+
 func (p *statefulParser) parseFormatters() (FormattingPipeline, error) {
 	// at this point we should be just before the [, skip to next char
+	openPos := p.idx
 	p.nextChr()
 	formatters := make([]Formatter, 0)
 
 	// switch by formatter type
 	for !p.isLast() && p.peek() != ']' {
 		chr := p.peek()
-		if chr == ',' { // multiple formatters, skip the comma and move to the next
+		if chr == ',' && len(formatters) > 0 { // multiple formatters, skip the comma and move to the next
 			p.nextChr()
 			chr = p.peek()
 		}
+		if p.isLast() || chr == ']' || chr == ',' {
+			return nil, p.errorAt(p.idx, "Missing formatter")
+		}
 		var formatter Formatter
 		var err error
 		switch chr {
@@ -162,14 +351,23 @@ func (p *statefulParser) parseFormatters() (FormattingPipeline, error) {
 			formatter, err = p.parseSliceFormatter()
 		case '/': // replacing
 			formatter, err = p.parseReplacingFormatter()
+		case '@': // date
+			formatter, err = p.parseDateFormatter()
+		case '^': // case
+			formatter, err = p.parseCaseFormatter()
+		case '~': // transliteration
+			formatter, err = p.parseTransliterateFormatter()
 		default:
-			return nil, fmt.Errorf("Unknown formatter type %s", string(chr))
+			return nil, p.errorAt(p.idx, "Unknown formatter type %s", string(chr))
 		}
 		if err != nil {
 			return nil, err
 		}
 		formatters = append(formatters, formatter)
 	}
+	if p.isLast() {
+		return nil, p.errorAt(openPos, "Unclosed [ in formatter list")
+	}
 
 	return formatters, nil
 }
@@ -178,17 +376,41 @@ func (p *statefulParser) parsePaddingFormatter() (*PaddingFormatter, error) {
 	// at this point we should be peeking at the %
 	p.nextChr() // %
 
+	if p.isLast() {
+		return &PaddingFormatter{}, p.errorAt(p.idx, "Missing padding character")
+	}
 	padChar := p.nextChr()
 
+	lengthPos := p.idx
 	padLength := ""
-	for !p.isLast() && (p.peek() != ']' && p.peek() != ',') {
+	for !p.isLast() && unicode.IsDigit(p.peek()) {
 		padLength += string(p.nextChr())
 	}
 	padLengthInt, err := strconv.Atoi(padLength)
 	if err != nil {
-		return &PaddingFormatter{}, err
+		for !p.isLast() && (p.peek() != ']' && p.peek() != ',') {
+			padLength += string(p.nextChr())
+		}
+		return &PaddingFormatter{}, p.errorAt(lengthPos, "Invalid padding length \"%s\", the length must be a number", padLength)
 	}
 	padder := NewPaddingFormatter(padChar, padLengthInt)
+
+	// alignment and display width flags
+	for !p.isLast() && (p.peek() != ']' && p.peek() != ',') {
+		switch p.peek() {
+		case '<':
+			padder.Align = PadAlignLeft
+		case '>':
+			padder.Align = PadAlignRight
+		case '^':
+			padder.Align = PadAlignCenter
+		case 'w':
+			padder.DisplayWidth = true
+		default:
+			return &PaddingFormatter{}, p.errorAt(p.idx, "Unknown padding option %s, supported options are <, >, ^, and w", string(p.peek()))
+		}
+		p.nextChr()
+	}
 	return &padder, nil
 }
 
@@ -198,8 +420,11 @@ func (p *statefulParser) parseSliceFormatter() (*SliceFormatter, error) {
 	startPos := -1
 	startPosStr := ""
 	for !p.isLast() && p.peek() != ':' {
+		if p.peek() == ']' || p.peek() == ',' {
+			return &SliceFormatter{}, p.errorAt(p.idx, "Missing : in slice formatter, the format is >[start]:[end]")
+		}
 		if !unicode.IsDigit(p.peek()) {
-			return &SliceFormatter{}, fmt.Errorf("Found %s in beginning position of slice formatter, only numeric values are allowed", string(p.peek()))
+			return &SliceFormatter{}, p.errorAt(p.idx, "Found %s in beginning position of slice formatter, only numeric values are allowed", string(p.peek()))
 		}
 		startPosStr += string(p.nextChr())
 	}
@@ -211,12 +436,15 @@ func (p *statefulParser) parseSliceFormatter() (*SliceFormatter, error) {
 		startPos = startPosTmp
 	}
 
+	if p.isLast() {
+		return &SliceFormatter{}, p.errorAt(p.idx, "Missing : in slice formatter, the format is >[start]:[end]")
+	}
 	p.nextChr() // skip the :
 	endPos := -1
 	endPosStr := ""
 	for !p.isLast() && (p.peek() != ']' && p.peek() != ',') {
 		if !unicode.IsDigit(p.peek()) {
-			return &SliceFormatter{}, fmt.Errorf("Found %s in end position of slice formatter, only numeric values are allowed", string(p.peek()))
+			return &SliceFormatter{}, p.errorAt(p.idx, "Found %s in end position of slice formatter, only numeric values are allowed", string(p.peek()))
 		}
 		endPosStr += string(p.nextChr())
 	}
@@ -232,38 +460,173 @@ func (p *statefulParser) parseSliceFormatter() (*SliceFormatter, error) {
 }
 
 func (p *statefulParser) parseReplacingFormatter() (*ReplacingFormatter, error) {
+	openPos := p.idx
 	p.nextChr() // skip the /
 
+	// escape sequences are kept in the pattern, \/ matches a / in regular expressions
+	findPos := p.idx
 	find := ""
-	for !p.isLast() {
-		if p.peek() == '/' && p.cur() != '\\' {
-			break
+	for !p.isLast() && p.peek() != '/' {
+		if p.peek() == '\\' && p.idx+1 < p.len {
+			find += string(p.nextChr())
 		}
 		find += string(p.nextChr())
 	}
+	if p.isLast() {
+		return &ReplacingFormatter{}, p.errorAt(openPos, "Unclosed / in replacing formatter, the format is /find/replace/")
+	}
 
 	p.nextChr() // skip the /
 
+	// in the replacement \/ is a literal / and \\ a literal backslash
 	replace := ""
-	for !p.isLast() {
-		if p.peek() == '/' && p.cur() != '\\' {
-			break
+	for !p.isLast() && p.peek() != '/' {
+		chr := p.nextChr()
+		if chr == '\\' && !p.isLast() && (p.peek() == '/' || p.peek() == '\\') {
+			chr = p.nextChr()
 		}
-		replace += string(p.nextChr())
+		replace += string(chr)
+	}
+	if p.isLast() {
+		return &ReplacingFormatter{}, p.errorAt(openPos, "Unclosed / in replacing formatter, the format is /find/replace/")
 	}
 
 	p.nextChr() // skip the final /
 
-	formatter, err := NewReplacingFormatter(find, replace)
-	return &formatter, err
+	flags := ""
+	for !p.isLast() && p.peek() != ']' && p.peek() != ',' {
+		flag := p.peek()
+		if flag != ReplaceFlagIgnoreCase && flag != ReplaceFlagFirst {
+			return &ReplacingFormatter{}, p.errorAt(p.idx, "Unknown replacing formatter flag %s, supported flags are i and f", string(flag))
+		}
+		flags += string(p.nextChr())
+	}
+
+	formatter, err := NewReplacingFormatterWithFlags(find, replace, flags)
+	if err != nil {
+		pos, msg := regexErrorPos(find, err)
+		return &formatter, p.errorAt(findPos+pos, "Invalid regular expression in replacing formatter: %s", msg)
+	}
+	return &formatter, nil
+}
+
+func (p *statefulParser) parseDateFormatter() (*DateFormatter, error) {
+	openPos := p.idx
+	p.nextChr() // skip the @
+
+	// parts holds the input layout, the output layout, and the time zone, along with the position
+	// of each character in the output definition
+	parts := [3][]rune{}
+	positions := [3][]int{}
+	part := 1
+	hasInput := false
+	for !p.isLast() && p.peek() != ']' && p.peek() != ',' {
+		pos := p.idx
+		chr := p.nextChr()
+		if chr == '\\' && !p.isLast() {
+			pos = p.idx
+			chr = p.nextChr()
+		} else if chr == '>' && part == 1 && !hasInput {
+			hasInput = true
+			parts[0], positions[0] = parts[1], positions[1]
+			parts[1], positions[1] = nil, nil
+			continue
+		} else if chr == '~' && part == 1 {
+			part = 2
+			continue
+		}
+		parts[part] = append(parts[part], chr)
+		positions[part] = append(positions[part], pos)
+	}
+	if len(parts[1]) == 0 {
+		return &DateFormatter{}, p.errorAt(openPos, "Missing output layout in date formatter, the format is @[input>]output[~zone]")
+	}
+	if part == 2 && len(parts[2]) == 0 {
+		return &DateFormatter{}, p.errorAt(p.idx, "Missing time zone after ~ in date formatter")
+	}
+
+	formatter, err := NewDateFormatter(string(parts[0]), string(parts[1]), string(parts[2]))
+	if err != nil {
+		if layoutErr, ok := err.(*strftimeError); ok {
+			// the input layout is validated first
+			layout := 1
+			if _, inErr := newStrftimeInput(string(parts[0])); len(parts[0]) > 0 && inErr != nil {
+				layout = 0
+			}
+			return &formatter, p.errorAt(positions[layout][layoutErr.Pos], "%s", layoutErr.Msg)
+		}
+		if part == 2 {
+			return &formatter, p.errorAt(positions[2][0], "%s", err)
+		}
+		return &formatter, p.errorAt(openPos, "%s", err)
+	}
+	return &formatter, nil
+}
+
+func (p *statefulParser) parseCaseFormatter() (*CaseFormatter, error) {
+	p.nextChr() // skip the ^
+
+	modePos := p.idx
+	mode := ""
+	for !p.isLast() && p.peek() != ']' && p.peek() != ',' && p.peek() != ':' {
+		mode += string(p.nextChr())
+	}
+	localePos := p.idx + 1
+	locale := ""
+	if !p.isLast() && p.peek() == ':' {
+		p.nextChr()
+		for !p.isLast() && p.peek() != ']' && p.peek() != ',' {
+			locale += string(p.nextChr())
+		}
+		if locale == "" {
+			return &CaseFormatter{}, p.errorAt(localePos, "Missing language after : in case formatter")
+		}
+	}
+
+	known := false
+	for _, m := range caseModes {
+		known = known || m == mode
+	}
+	if !known {
+		err := p.errorAt(modePos, "Unknown case conversion \"%s\", supported conversions are %s", mode, strings.Join(caseModes, ", "))
+		err.Suggestion = suggestCaseMode(mode)
+		return &CaseFormatter{}, err
+	}
+	formatter, err := NewCaseFormatter(mode, locale)
+	if err != nil {
+		return &formatter, p.errorAt(localePos, "Invalid language %s in case formatter", locale)
+	}
+	return &formatter, nil
+}
+
+func (p *statefulParser) parseTransliterateFormatter() (*TransliterateFormatter, error) {
+	p.nextChr() // skip the ~
+
+	formatter := NewTransliterateFormatter(DefaultTransliterationReplacement)
+	if p.isLast() || p.peek() == ']' || p.peek() == ',' {
+		return &formatter, nil
+	}
+	replacementPos := p.idx
+	formatter.Replacement = p.nextChr()
+	if formatter.Replacement > unicode.MaxASCII {
+		return &formatter, p.errorAt(replacementPos, "The replacement character %s is not ASCII", string(formatter.Replacement))
+	}
+	if !p.isLast() && p.peek() != ']' && p.peek() != ',' {
+		return &formatter, p.errorAt(p.idx, "The transliteration formatter accepts a single replacement character")
+	}
+	return &formatter, nil
 }
 
 func (p *statefulParser) parseLiteral() (Token, error) {
+	start := p.idx
 	str := ""
 	for !p.isLast() && p.peek() != '$' {
 		nextChr := p.nextChr()
 		// remove escapes
 		if nextChr == '\\' {
+			if p.isLast() {
+				return Token{}, p.errorAt(p.idx-1, "Trailing \\ does not escape any character")
+			}
 			nextChr = p.nextChr()
 		}
 		str += string(nextChr)
@@ -273,5 +636,87 @@ func (p *statefulParser) parseLiteral() (Token, error) {
 		Type:      TokenTypeLiteral,
 		Value:     str,
 		Formatter: nil,
+		Pos:       start,
 	}, nil
 }
+
+// ValidateOutputVars checks that every property referenced by the token stream is either an intrinsic
+// variable or one of the declared variables. The raw output definition is used to report the position
+// of unknown variables, along with the closest declared name as a suggestion.
+func ValidateOutputVars(raw string, tokens TokenStream, declared []string) error {
+	known, candidates := knownVarNames(declared)
+
+	for _, t := range propertyTokens(tokens) {
+		if known[t.Value] {
+			continue
+		}
+		err := newParseError(raw, t.Pos, "Unknown variable %s", t.Value)
+		err.Suggestion = suggest(t.Value, candidates)
+		return err
+	}
+	return nil
+}
+
+// knownVarNames returns the declared variables and the intrinsics as a set and as a list of candidates
+// for suggestions
+func knownVarNames(declared []string) (map[string]bool, []string) {
+	known := make(map[string]bool)
+	candidates := make([]string, 0)
+	for _, name := range declared {
+		known[name] = true
+		candidates = append(candidates, name)
+	}
+	for name := range ReservedVarNames {
+		known[name] = true
+		candidates = append(candidates, name)
+	}
+	return known, candidates
+}
+
+// ResolveGroupReferences turns the capture group references that do not match a declared variable back
+// into a variable followed by literal text: in "Show.E$ep.1080p.mkv" the .1080 is part of the name
+// unless $ep.1080 is declared. References with formatters or options are left for ValidateOutputVars
+// to report.
+func ResolveGroupReferences(tokens TokenStream, declared []string) TokenStream {
+	known, _ := knownVarNames(declared)
+	return resolveGroupReferences(tokens, known)
+}
+
+func resolveGroupReferences(tokens TokenStream, known map[string]bool) TokenStream {
+	out := make(TokenStream, 0, len(tokens))
+	for _, t := range tokens {
+		switch t.Type {
+		case TokenTypeGroup:
+			alternatives := make([]TokenStream, len(t.Alternatives))
+			for idx, alt := range t.Alternatives {
+				alternatives[idx] = resolveGroupReferences(alt, known)
+			}
+			t.Alternatives = alternatives
+			if t.Fallback != nil {
+				t.Fallback = resolveGroupReferences(t.Fallback, known)
+			}
+		case TokenTypeProperty:
+			dot := strings.Index(t.Value, ".")
+			if dot > 0 && !known[t.Value] && known[t.Value[:dot]] && t.Formatter == nil && t.Options == nil {
+				out = append(out, Token{Type: TokenTypeProperty, Value: t.Value[:dot], Pos: t.Pos})
+				out = appendLiteral(out, t.Value[dot:], t.Pos+len([]rune(t.Value[:dot])))
+				continue
+			}
+		case TokenTypeLiteral:
+			out = appendLiteral(out, t.Value, t.Pos)
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// appendLiteral appends literal text to the token stream, merging it with the last token if that is
+// also a literal
+func appendLiteral(tokens TokenStream, text string, pos int) TokenStream {
+	if len(tokens) > 0 && tokens[len(tokens)-1].Type == TokenTypeLiteral {
+		tokens[len(tokens)-1].Value += text
+		return tokens
+	}
+	return append(tokens, Token{Type: TokenTypeLiteral, Value: text, Pos: pos})
+}
@@ -141,6 +141,25 @@ func TestPaddingFormatterInCnt(t *testing.T) {
 	assert.Equal(t, '0', pformatter.PadCharacter)
 }
 
+func TestPaddingFormatterOptions(t *testing.T) {
+	tokens, err := ParseOutput("$title[%.20^w]")
+	assert.Nil(t, err)
+	pformatter, ok := tokens[0].Formatter[0].(*PaddingFormatter)
+	assert.True(t, ok)
+	assert.Equal(t, 20, pformatter.PadLength)
+	assert.Equal(t, PadAlignCenter, pformatter.Align)
+	assert.True(t, pformatter.DisplayWidth)
+
+	tokens, err = ParseOutput("$title[%.20<,>:30]")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens[0].Formatter))
+	assert.Equal(t, PadAlignLeft, tokens[0].Formatter[0].(*PaddingFormatter).Align)
+
+	_, err = ParseOutput("$title[%.20x]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 11, err.(*ParseError).Pos)
+}
+
 func TestSliceFormatterParser(t *testing.T) {
 	parser := newParser("$title[>:10]") // max 50 chars
 	tokens, err := parser.parse()
@@ -218,6 +237,31 @@ func TestEscapeReplacingFormatterParser(t *testing.T) {
 	formatter := tokens[0].Formatter[0].(*ReplacingFormatter)
 	assert.Equal(t, "[A-Z][a-z\\/]+", formatter.PatternString)
 	assert.Equal(t, "world", formatter.Value)
+
+	// escaped slash in the replacement and escaped backslash before the closing slash
+	tokens, err = ParseOutput("$title[/-/\\/\\\\/]")
+	assert.Nil(t, err)
+	formatter = tokens[0].Formatter[0].(*ReplacingFormatter)
+	assert.Equal(t, "/\\", formatter.Value)
+	val, err := formatter.Format("a-b", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a/\\b", val)
+}
+
+func TestReplacingFormatterParserFlags(t *testing.T) {
+	tokens, err := ParseOutput("$title[/(\\w+) of/$1/if,>:5]")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens[0].Formatter))
+	formatter := tokens[0].Formatter[0].(*ReplacingFormatter)
+	assert.Equal(t, "if", formatter.Flags)
+	assert.Equal(t, "/(\\w+) of/$1/if", formatter.String())
+	val, err := formatter.Format("Lord OF the Rings OF Power", renamerState{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Lord the Rings OF Power", val)
+
+	_, err = ParseOutput("$title[/a/b/g]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 12, err.(*ParseError).Pos)
 }
 
 func TestUnknownFormatter(t *testing.T) {
@@ -225,5 +269,178 @@ func TestUnknownFormatter(t *testing.T) {
 	_, err := parser.parse()
 
 	assert.NotNil(t, err)
-	assert.EqualError(t, err, "Unknown formatter type +")
+	assert.EqualError(t, err, "Unknown formatter type + at column 6\n  $cnt[+10]\n       ^")
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	_, err := ParseOutput("test - $title[>:10")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Unclosed [ in formatter list", err.(*ParseError).Msg)
+	assert.Equal(t, 13, err.(*ParseError).Pos)
+
+	// slice formatters cut off before the :
+	for _, raw := range []string{"$f[>", "$f[>1", "${0}[>"} {
+		_, err = ParseOutput(raw)
+		assert.IsType(t, &ParseError{}, err, raw)
+		assert.Equal(t, "Missing : in slice formatter, the format is >[start]:[end]", err.(*ParseError).Msg, raw)
+		assert.Equal(t, len(raw), err.(*ParseError).Pos, raw)
+	}
+
+	_, err = ParseOutput("$title[/\\./ ]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 7, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$cnt[%0a]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 7, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$title[/(abc/x/]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$cnt[%03,]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Missing formatter", err.(*ParseError).Msg)
+
+	_, err = ParseOutput("price $ 10")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 6, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("trailing \\")
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestValidateOutputVars(t *testing.T) {
+	raw := "show - $cnt - $titel$ext"
+	tokens, err := ParseOutput(raw)
+	assert.Nil(t, err)
+
+	err = ValidateOutputVars(raw, tokens, []string{"$title", "$season"})
+	assert.IsType(t, &ParseError{}, err)
+	parseErr := err.(*ParseError)
+	assert.Equal(t, 14, parseErr.Pos)
+	assert.Equal(t, "$title", parseErr.Suggestion)
+	assert.Equal(t, "Unknown variable $titel at column 15, did you mean `$title`?\n  "+raw+"\n                ^", err.Error())
+
+	err = ValidateOutputVars(raw, tokens, []string{"$titel"})
+	assert.Nil(t, err)
+
+	// intrinsics are suggested too
+	err = ValidateOutputVars(raw, tokens, []string{"$season"})
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "$total", err.(*ParseError).Suggestion)
+
+	// nothing close enough to suggest
+	raw = "show - $episodename$ext"
+	tokens, err = ParseOutput(raw)
+	assert.Nil(t, err)
+	err = ValidateOutputVars(raw, tokens, []string{"$season"})
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "", err.(*ParseError).Suggestion)
+}
+
+func TestResolveGroupReferences(t *testing.T) {
+	raw := "Show.E$ep.1080p - $re.1 - ${ep.2:-x}.mkv"
+	tokens, err := ParseOutput(raw)
+	assert.Nil(t, err)
+	declared := []string{"$ep", "$re", "$re.1"}
+	tokens = ResolveGroupReferences(tokens, declared)
+	assert.Nil(t, ValidateOutputVars(raw, tokens, declared))
+
+	assert.Equal(t, "$ep", tokens[1].Value)
+	assert.Equal(t, TokenTypeLiteral, tokens[2].Type)
+	assert.Equal(t, ".1080p - ", tokens[2].Value)
+	assert.Equal(t, 9, tokens[2].Pos)
+	assert.Equal(t, "$re.1", tokens[3].Value)
+	assert.Equal(t, "$ep", tokens[5].Alternatives[0][0].Value)
+	assert.Equal(t, ".2", tokens[5].Alternatives[0][1].Value)
+
+	name, _, err := GenerateName(VarValues{"$ep": "02", "$re": "a", "$re.1": "b"}, tokens, renamerState{}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Show.E02.1080p - b - 02.2.mkv", name)
+
+	// groups that are not declared and carry formatters are still reported
+	raw = "$ep.1[%03]"
+	tokens, err = ParseOutput(raw)
+	assert.Nil(t, err)
+	tokens = ResolveGroupReferences(tokens, declared)
+	assert.IsType(t, &ParseError{}, ValidateOutputVars(raw, tokens, declared))
+}
+
+func TestParseGroup(t *testing.T) {
+	tokens, err := ParseOutput("Show - ${title:-Untitled}${ - $subtitle}.mkv")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(tokens))
+
+	group := tokens[1]
+	assert.Equal(t, TokenTypeGroup, group.Type)
+	assert.Equal(t, "${title:-Untitled}", group.Value)
+	assert.Equal(t, 7, group.Pos)
+	assert.Equal(t, 1, len(group.Alternatives))
+	assert.Equal(t, "$title", group.Alternatives[0][0].Value)
+	assert.Equal(t, 9, group.Alternatives[0][0].Pos)
+	assert.Equal(t, "Untitled", group.Fallback[0].Value)
+
+	conditional := tokens[2]
+	assert.Equal(t, TokenTypeGroup, conditional.Type)
+	assert.Nil(t, conditional.Fallback)
+	assert.Equal(t, 2, len(conditional.Alternatives[0]))
+	assert.Equal(t, " - ", conditional.Alternatives[0][0].Value)
+	assert.Equal(t, "$subtitle", conditional.Alternatives[0][1].Value)
+	assert.Equal(t, 30, conditional.Alternatives[0][1].Pos)
+}
+
+func TestParseGroupAlternatives(t *testing.T) {
+	tokens, err := ParseOutput("${a|b[/x|y/z/]|$c$cnt{start=5}:-}[^upper]")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tokens))
+	group := tokens[0]
+	assert.Equal(t, 3, len(group.Alternatives))
+	assert.Equal(t, "$b", group.Alternatives[1][0].Value)
+	assert.Equal(t, 1, len(group.Alternatives[1][0].Formatter))
+	assert.Equal(t, 2, len(group.Alternatives[2]))
+	assert.Equal(t, 1, len(group.Alternatives[2][1].Options))
+	assert.NotNil(t, group.Fallback)
+	assert.Equal(t, 0, len(group.Fallback))
+	assert.Equal(t, 1, len(group.Formatter))
+
+	// nested groups and escapes
+	tokens, err = ParseOutput("${ - ${subtitle|episode} \\| \\}}")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tokens))
+	nested := tokens[0].Alternatives[0]
+	assert.Equal(t, TokenTypeGroup, nested[1].Type)
+	assert.Equal(t, " | }", nested[2].Value)
+
+	// the existing syntax keeps working
+	tokens, err = ParseOutput("$title[>:5]{x}")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens))
+	assert.Equal(t, "{x}", tokens[1].Value)
+}
+
+func TestParseGroupErrors(t *testing.T) {
+	_, err := ParseOutput("Show ${title:-Untitled")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("${title||fname}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Missing alternative in ${...}", err.(*ParseError).Msg)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("${title[%0a]}")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 10, err.(*ParseError).Pos)
+
+	err = ValidateOutputVars("${title|fnme}", mustParseOutput(t, "${title|fnme}"), []string{"$title"})
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+	assert.Equal(t, "$fname", err.(*ParseError).Suggestion)
+}
+
+func mustParseOutput(t *testing.T, out string) TokenStream {
+	tokens, err := ParseOutput(out)
+	assert.Nil(t, err)
+	return tokens
 }
@@ -1,41 +1,437 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
+const (
+	// PropMatchFirst selects the leftmost match of the regex. This is the default
+	PropMatchFirst = 0
+	// PropMatchLast selects the rightmost match of the regex
+	PropMatchLast = -1
+	// PropMatchAll tells extractVarValues to collect every match of the regex and join the values
+	// using the prop Separator
+	PropMatchAll = -2
+)
+
+const (
+	// PropOptional props are assigned their default value, or an empty string, when the regex does
+	// not match the file name. This is the default
+	PropOptional = iota
+	// PropRequiredSkip props cause raf to skip files whose name is not matched by the regex
+	PropRequiredSkip
+	// PropRequiredFail props cause raf to stop with an error when the regex does not match a file name
+	PropRequiredFail
+)
+
+const (
+	// PropScopeName runs the prop regex against the file name. This is the default
+	PropScopeName = "name"
+	// PropScopeStem runs the prop regex against the file name without its extension
+	PropScopeStem = "stem"
+	// PropScopePath runs the prop regex against the absolute path of the file
+	PropScopePath = "path"
+	// PropScopeDir runs the prop regex against the absolute path of the directory containing the file
+	PropScopeDir = "dir"
+	// PropScopeParent runs the prop regex against the name of the directory containing the file
+	PropScopeParent = "parent"
+)
+
+// propFlags lists the flags that can follow a regex declared in the /regex/flags form: i makes the
+// regex case-insensitive, s lets . match new lines, and a anchors the regex to the file name stem
+const propFlags = "isa"
+
 // Prop defines a property that can be used in the RenameAllFiles to extract
-// values from the original file name.
+// values from the original file name. A prop makes its value available as $name. Each capture
+// group in the regex is also available by number, with $name.0 containing the full match, and
+// named capture groups - (?P<show>.+) - define a variable with the name of the group: $show.
 type Prop struct {
-	Name    string
+	Name string
+	// Matcher is the regular expression as declared by the user, without flags
 	Matcher string
-	Regex   *regexp.Regexp
+	// Flags contains the flags declared after the regular expression
+	Flags string
+	Regex *regexp.Regexp
+	// Anchored props must match the entire stem of the file name - the name without its extension
+	Anchored bool
+	// Match selects which of the regex matches in the file name is used: PropMatchFirst,
+	// PropMatchLast, PropMatchAll, or a positive number for the nth match starting from 1
+	Match int
+	// Separator is used to join the values when Match is PropMatchAll
+	Separator string
+	// Default is assigned to the prop when the regex does not match the file name
+	Default string
+	// Required tells raf what to do when the regex does not match a file name: PropOptional,
+	// PropRequiredSkip, or PropRequiredFail
+	Required int
+	// Source is the name of the variable, including the $ prefix, the regex runs against. When
+	// empty, the regex runs against the portion of the file path selected by Scope. Source variables
+	// must be defined by other props.
+	Source string
+	// Scope selects the portion of the file path the regex runs against: PropScopeName,
+	// PropScopeStem, PropScopePath, PropScopeDir, or PropScopeParent. Empty means PropScopeName
+	Scope string
+}
+
+// PropNotMatchedError is returned by extractVarValues when a required prop does not match the
+// name of a file
+type PropNotMatchedError struct {
+	Prop     Prop
+	FileName string
 }
 
-// ParseProp populates a Prop object based on the string format passed to the cli: "propName=/regex/"
+func (e *PropNotMatchedError) Error() string {
+	return fmt.Sprintf("File %s does not match the required property $%s: %s", e.FileName, e.Prop.Name, e.Prop.Matcher)
+}
+
+// ParseProp populates a Prop object based on the string format passed to the cli: "propName=/regex/flags"
+// or simply "propName=regex". Only the first = separates the name from the regex and references to
+// Macros in the regex - {date} - are expanded before compiling it. The name can be
+// followed by a list of options in curly braces: "tags{match=all,sep=+}=/regex/". Supported options
+// are match - first, last, all, or the 1-based index of a match -, sep, the separator used to join
+// all matches, default, the value assigned when the regex does not match, and required - skip or
+// fail. A ! before the = is a shorthand for required=fail: "title!=/regex/". The name can be followed
+// by a scope to run the regex against a different portion of the file path: "album@parent=(.+)". The
+// regex can also run against the value of another prop: "word=$title:^(\w+)".
 func ParseProp(v string) (Prop, error) {
-	kv := strings.Split(v, "=")
-	if len(kv) != 2 {
-		return Prop{}, fmt.Errorf("Invalid property definition %s. Property definitions must contain a name and a matcher: name=/matcher/", v)
+	runes := []rune(v)
+	pos := 0
+	for pos < len(runes) && (unicode.IsLetter(runes[pos]) || unicode.IsDigit(runes[pos])) {
+		pos++
+	}
+	name := string(runes[:pos])
+
+	scope := ""
+	scopePos := pos
+	if pos < len(runes) && runes[pos] == '@' {
+		pos++
+		for pos < len(runes) && unicode.IsLetter(runes[pos]) {
+			pos++
+		}
+		scope = string(runes[scopePos+1 : pos])
+		switch scope {
+		case PropScopeName, PropScopeStem, PropScopePath, PropScopeDir, PropScopeParent:
+		default:
+			err := newParseError(v, scopePos+1, "Unknown property scope %s, supported scopes are name, stem, path, dir, and parent", scope)
+			err.Suggestion = suggest(scope, []string{PropScopeName, PropScopeStem, PropScopePath, PropScopeDir, PropScopeParent})
+			return Prop{}, err
+		}
+	}
+
+	options := make([]option, 0)
+	if pos < len(runes) && runes[pos] == '{' {
+		var err error
+		options, pos, err = parseOptionList(v, pos)
+		if err != nil {
+			return Prop{}, err
+		}
+	}
+	required := false
+	if pos < len(runes) && runes[pos] == '!' {
+		required = true
+		pos++
+	}
+	if pos >= len(runes) {
+		return Prop{}, newParseError(v, pos, "Invalid property definition. Property definitions must contain a name and a matcher: name=/matcher/")
+	}
+	if runes[pos] != '=' {
+		return Prop{}, newParseError(v, pos, "Invalid character %s in property name, names can only contain letters and digits", string(runes[pos]))
+	}
+	if name == "" {
+		return Prop{}, newParseError(v, 0, "Missing property name")
+	}
+	if reservedVarNames["$"+name] {
+		return Prop{}, newParseError(v, 0, "The property name %s is reserved", name)
+	}
+
+	matcherPos := pos + 1
+	source := ""
+	if sourceLen := parseSourcePrefix(runes[matcherPos:]); sourceLen > 0 {
+		source = string(runes[matcherPos : matcherPos+sourceLen])
+		matcherPos += sourceLen + 1 // skip the :
+	}
+	matcher, flags := splitMatcherFlags(string(runes[matcherPos:]))
+	if matcher != string(runes[matcherPos:]) {
+		matcherPos++ // skip the opening /
+	}
+	expanded, spans, err := expandMacros(matcher, 0)
+	if err != nil {
+		var macroErr *ParseError
+		if errors.As(err, &macroErr) {
+			parseErr := newParseError(v, matcherPos+macroErr.Pos, "%s", macroErr.Msg)
+			parseErr.Suggestion = macroErr.Suggestion
+			return Prop{}, parseErr
+		}
+		return Prop{}, err
+	}
+	prop, err := NewPropWithFlags(name, expanded, flags)
+	if err != nil {
+		regexErr := errors.Unwrap(err)
+		if regexErr == nil {
+			return Prop{}, err
+		}
+		pos, msg := regexErrorPos(expanded, regexErr)
+		pos, span := expandedPos(pos, spans)
+		if span != nil {
+			return Prop{}, newParseError(v, matcherPos+pos, "Invalid matcher in the macro {%s}: %s", span.Name, msg)
+		}
+		return Prop{}, newParseError(v, matcherPos+pos, "Invalid matcher: %s", msg)
+	}
+	prop.Matcher = matcher
+	prop.Source = source
+	prop.Scope = scope
+	if source != "" && scope != "" {
+		return Prop{}, newParseError(v, scopePos, "A property cannot declare both a scope and a source variable")
+	}
+
+	for _, o := range options {
+		switch o.Key {
+		case "match":
+			match, err := parseMatchOption(o.Value)
+			if err != nil {
+				return Prop{}, newParseError(v, o.Pos, "%s", err)
+			}
+			prop.Match = match
+		case "sep":
+			prop.Separator = o.Value
+		case "default":
+			prop.Default = o.Value
+		case "required":
+			switch o.Value {
+			case "", "fail":
+				prop.Required = PropRequiredFail
+			case "skip":
+				prop.Required = PropRequiredSkip
+			default:
+				return Prop{}, newParseError(v, o.Pos, "Invalid required option %s, supported values are skip and fail", o.Value)
+			}
+		default:
+			return Prop{}, newParseError(v, o.Pos, "Unknown property option %s", o.Key)
+		}
+	}
+	if required {
+		prop.Required = PropRequiredFail
+	}
+	return prop, nil
+}
+
+// parseSourcePrefix looks for a source variable at the beginning of a matcher, such as $title: in
+// "$title:^(\w+)", and returns the length of the variable name, excluding the colon. If the matcher
+// does not start with a source variable the function returns 0.
+func parseSourcePrefix(matcher []rune) int {
+	if len(matcher) < 3 || matcher[0] != '$' {
+		return 0
+	}
+	pos := 1
+	for pos < len(matcher) && (unicode.IsLetter(matcher[pos]) || unicode.IsDigit(matcher[pos]) || matcher[pos] == '.') {
+		pos++
 	}
-	if _, ok := ReservedVarNames[kv[0]]; ok {
-		return Prop{}, fmt.Errorf("The property name %s is reserved", kv[0])
+	if pos == 1 || pos >= len(matcher) || matcher[pos] != ':' {
+		return 0
 	}
-	return NewProp(kv[0], kv[1])
+	return pos
+}
+
+// sortByDependencies orders the items so that each item comes after the items it depends on, the
+// deps function returns the indexes of the dependencies of the item at idx. Items without dependencies
+// keep their relative order. The function returns the sorted indexes, or an error starting with
+// cycleMsg and listing the names of the items forming a cycle.
+func sortByDependencies(names []string, deps func(idx int) ([]int, error), cycleMsg string) ([]int, error) {
+	sorted := make([]int, 0, len(names))
+	// 0 = not visited, 1 = visiting, 2 = done
+	state := make([]int, len(names))
+	var visit func(idx int, path []string) error
+	visit = func(idx int, path []string) error {
+		path = append(path, names[idx])
+		switch state[idx] {
+		case 1:
+			return fmt.Errorf("%s: %s", cycleMsg, strings.Join(path, " -> "))
+		case 2:
+			return nil
+		}
+		state[idx] = 1
+		depIdxs, err := deps(idx)
+		if err != nil {
+			return err
+		}
+		for _, dep := range depIdxs {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[idx] = 2
+		sorted = append(sorted, idx)
+		return nil
+	}
+	for idx := range names {
+		if err := visit(idx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// SortProps orders the props so that each prop comes after the props defining its Source variable.
+// Props without dependencies keep their relative order. The function returns an error if a prop
+// reads from a variable that no prop declares or if the sources form a cycle.
+func SortProps(p []Prop) ([]Prop, error) {
+	names := make([]string, len(p))
+	definedBy := make(map[string]int)
+	for idx, prop := range p {
+		names[idx] = "$" + prop.Name
+		for _, name := range prop.VarNames() {
+			definedBy[name] = idx
+		}
+	}
+
+	order, err := sortByDependencies(names, func(idx int) ([]int, error) {
+		prop := p[idx]
+		if prop.Source == "" {
+			return nil, nil
+		}
+		dep, ok := definedBy[prop.Source]
+		if !ok {
+			return nil, fmt.Errorf("The property $%s reads from %s which is not declared by any property", prop.Name, prop.Source)
+		}
+		return []int{dep}, nil
+	}, "The property sources form a cycle")
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]Prop, len(order))
+	for pos, idx := range order {
+		sorted[pos] = p[idx]
+	}
+	return sorted, nil
+}
+
+// sourceValue returns the string the prop regex runs against: the value of the Source variable, or
+// the portion of the file path selected by the prop Scope. Anchored props scoped to the file name
+// run against its stem.
+func (p *Prop) sourceValue(rstate renamerState, varValues VarValues) string {
+	if p.Source != "" {
+		return varValues[p.Source]
+	}
+	switch p.Scope {
+	case PropScopePath:
+		return rstate.path
+	case PropScopeDir:
+		return filepath.Dir(rstate.path)
+	case PropScopeParent:
+		return filepath.Base(filepath.Dir(rstate.path))
+	case PropScopeStem:
+		return rstate.stem
+	}
+	if p.Anchored {
+		return rstate.stem
+	}
+	return rstate.fileName
+}
+
+// splitMatcherFlags separates a matcher declared as /regex/flags into the regex and its flags. If
+// the matcher is not enclosed in slashes, the function returns it unchanged with no flags.
+func splitMatcherFlags(matcher string) (string, string) {
+	if len(matcher) < 2 || matcher[0] != '/' {
+		return matcher, ""
+	}
+	closing := strings.LastIndex(matcher, "/")
+	if closing == 0 || strings.Trim(matcher[closing+1:], propFlags) != "" {
+		return matcher, ""
+	}
+	// the closing / must not be escaped
+	escapes := 0
+	for idx := closing - 1; idx > 0 && matcher[idx] == '\\'; idx-- {
+		escapes++
+	}
+	if escapes%2 == 1 {
+		return matcher, ""
+	}
+	return matcher[1:closing], matcher[closing+1:]
+}
+
+func parseMatchOption(value string) (int, error) {
+	switch value {
+	case "first":
+		return PropMatchFirst, nil
+	case "last":
+		return PropMatchLast, nil
+	case "all":
+		return PropMatchAll, nil
+	}
+	nth, err := strconv.Atoi(value)
+	if err != nil || nth < 1 {
+		return 0, fmt.Errorf("Invalid match option %s, supported values are first, last, all, or the position of the match starting from 1", value)
+	}
+	return nth, nil
 }
 
 // NewProp creates a new Prop object for the given name and matcher regex. The regex string is compiled
 // into a RegEx struct.
 func NewProp(name, matcher string) (Prop, error) {
-	regex, err := regexp.Compile(matcher)
+	return NewPropWithFlags(name, matcher, "")
+}
+
+// NewPropWithFlags creates a new Prop object for the given name and matcher regex and applies the
+// flags to the compiled regex. Supported flags are i for case-insensitive matching, s to let . match
+// new lines, and a to anchor the regex to the entire stem of the file name.
+func NewPropWithFlags(name, matcher, flags string) (Prop, error) {
+	expr := matcher
+	anchored := false
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 's':
+			expr = "(?" + string(flag) + ")" + expr
+		case 'a':
+			anchored = true
+		default:
+			return Prop{}, fmt.Errorf("Unknown flag %s for matcher %s, supported flags are i, s, and a", string(flag), matcher)
+		}
+	}
+	if anchored {
+		expr = "^(?:" + expr + ")$"
+	}
+	regex, err := regexp.Compile(expr)
 	if err != nil {
-		return Prop{}, fmt.Errorf("Invalid matcher for pattern %s: Selector must be valid regular expressions. %v", matcher, err)
+		return Prop{}, fmt.Errorf("Invalid matcher for pattern %s: Selector must be valid regular expressions. %w", matcher, err)
+	}
+	for _, group := range regex.SubexpNames() {
+		if group == "" {
+			continue
+		}
+		for _, chr := range group {
+			if !unicode.IsLetter(chr) && !unicode.IsDigit(chr) {
+				return Prop{}, fmt.Errorf("Invalid capture group name %s in matcher %s, names can only contain letters and digits", group, matcher)
+			}
+		}
+		if reservedVarNames["$"+group] {
+			return Prop{}, fmt.Errorf("The capture group name %s in matcher %s is reserved", group, matcher)
+		}
 	}
 	return Prop{
-		Name:    name,
-		Matcher: matcher,
-		Regex:   regex,
+		Name:      name,
+		Matcher:   matcher,
+		Flags:     flags,
+		Regex:     regex,
+		Anchored:  anchored,
+		Separator: ",",
 	}, nil
 }
+
+// VarNames returns the names of all the variables defined by the prop, including the $ prefix: the
+// prop name, the numbered capture groups, and the named capture groups
+func (p *Prop) VarNames() []string {
+	names := []string{"$" + p.Name}
+	for idx, group := range p.Regex.SubexpNames() {
+		names = append(names, "$"+p.Name+"."+strconv.Itoa(idx))
+		if group != "" {
+			names = append(names, "$"+group)
+		}
+	}
+	return names
+}
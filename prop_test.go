@@ -1,6 +1,7 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,3 +13,185 @@ func TestPropParseSimple(t *testing.T) {
 	assert.Equal(t, "title", prop.Name)
 	assert.Equal(t, "\\ \\- ([A-Za-z0-9\\ ]+)\\ \\-", prop.Matcher)
 }
+
+func TestPropParseErrors(t *testing.T) {
+	_, err := ParseProp("title")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 5, err.(*ParseError).Pos)
+
+	_, err = ParseProp("cnt=(\\d+)")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "The property name cnt is reserved", err.(*ParseError).Msg)
+
+	_, err = ParseProp("my-title=(.+)")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 2, err.(*ParseError).Pos)
+
+	_, err = ParseProp("title=abc(def")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Invalid matcher: missing closing ): `abc(def`", err.(*ParseError).Msg)
+
+	_, err = ParseProp("title=abc[z-a]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 10, err.(*ParseError).Pos)
+}
+
+func TestPropReservedGroupName(t *testing.T) {
+	_, err := ParseProp("re=(?P<cnt>\\d+)")
+	assert.NotNil(t, err)
+
+	_, err = ParseProp("re=(?P<my_show>.+)")
+	assert.NotNil(t, err)
+}
+
+func TestPropParseOptions(t *testing.T) {
+	prop, err := ParseProp("tags{match=all,sep=+}=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	assert.Equal(t, "tags", prop.Name)
+	assert.Equal(t, PropMatchAll, prop.Match)
+	assert.Equal(t, "+", prop.Separator)
+	assert.Equal(t, "\\[(\\w+)\\]", prop.Matcher)
+
+	prop, err = ParseProp("tag{match=3}=\\d+")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, prop.Match)
+
+	_, err = ParseProp("tag{match=middle}=\\d+")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 4, err.(*ParseError).Pos)
+
+	_, err = ParseProp("tag{color=red}=\\d+")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Unknown property option color", err.(*ParseError).Msg)
+
+	_, err = ParseProp("tag{match=all=\\d+")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Unclosed { in option list", err.(*ParseError).Msg)
+}
+
+func TestPropParseFlags(t *testing.T) {
+	prop, err := ParseProp("title=/video (\\w+)/i")
+	assert.Nil(t, err)
+	assert.Equal(t, "video (\\w+)", prop.Matcher)
+	assert.Equal(t, "i", prop.Flags)
+	assert.True(t, prop.Regex.MatchString("VIDEO home"))
+
+	prop, err = ParseProp("title=/(\\w+) - (\\d+)/a")
+	assert.Nil(t, err)
+	assert.True(t, prop.Anchored)
+
+	// regex without slashes is unchanged
+	prop, err = ParseProp("path=/tmp/")
+	assert.Nil(t, err)
+	assert.Equal(t, "tmp", prop.Matcher)
+	prop, err = ParseProp("path=a/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "a/b", prop.Matcher)
+	assert.Equal(t, "", prop.Flags)
+
+	_, err = ParseProp("title=/(abc/i")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 7, err.(*ParseError).Pos)
+}
+
+func TestPropParseEqualsInRegex(t *testing.T) {
+	prop, err := ParseProp("key=key=(\\w+)")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", prop.Name)
+	assert.Equal(t, "key=(\\w+)", prop.Matcher)
+
+	prop, err = ParseProp("key{default=a=b}=/x=(\\w+)/i")
+	assert.Nil(t, err)
+	assert.Equal(t, "x=(\\w+)", prop.Matcher)
+	assert.Equal(t, "a=b", prop.Default)
+}
+
+func TestPropParseRequired(t *testing.T) {
+	prop, err := ParseProp("title!=(\\w+)")
+	assert.Nil(t, err)
+	assert.Equal(t, "title", prop.Name)
+	assert.Equal(t, PropRequiredFail, prop.Required)
+
+	prop, err = ParseProp("title{required=skip}=(\\w+)")
+	assert.Nil(t, err)
+	assert.Equal(t, PropRequiredSkip, prop.Required)
+
+	prop, err = ParseProp("title{default=Untitled}=(\\w+)")
+	assert.Nil(t, err)
+	assert.Equal(t, PropOptional, prop.Required)
+	assert.Equal(t, "Untitled", prop.Default)
+
+	_, err = ParseProp("title{required=maybe}=(\\w+)")
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestPropParseSource(t *testing.T) {
+	prop, err := ParseProp("word=$title:^(\\w+)")
+	assert.Nil(t, err)
+	assert.Equal(t, "$title", prop.Source)
+	assert.Equal(t, "^(\\w+)", prop.Matcher)
+
+	prop, err = ParseProp("word=$re.2:/^(\\w+)/i")
+	assert.Nil(t, err)
+	assert.Equal(t, "$re.2", prop.Source)
+	assert.Equal(t, "i", prop.Flags)
+
+	// an end anchor is not a source
+	prop, err = ParseProp("word=(\\w+)$")
+	assert.Nil(t, err)
+	assert.Equal(t, "", prop.Source)
+}
+
+func TestSortProps(t *testing.T) {
+	word, err := ParseProp("word=$title:^(\\w+)")
+	assert.Nil(t, err)
+	letter, err := ParseProp("letter=$word:^(\\w)")
+	assert.Nil(t, err)
+	title, err := ParseProp("title=- (.+)\\.")
+	assert.Nil(t, err)
+	show, err := ParseProp("re=^(?P<show>\\w+)")
+	assert.Nil(t, err)
+
+	sorted, err := SortProps([]Prop{letter, show, word, title})
+	assert.Nil(t, err)
+	names := make([]string, len(sorted))
+	for idx, p := range sorted {
+		names[idx] = p.Name
+	}
+	assert.Equal(t, []string{"title", "word", "letter", "re"}, names)
+
+	_, err = SortProps([]Prop{letter, word})
+	assert.EqualError(t, err, "The property $word reads from $title which is not declared by any property")
+
+	a, err := ParseProp("a=$b:(\\w+)")
+	assert.Nil(t, err)
+	b, err := ParseProp("b=$a:(\\w+)")
+	assert.Nil(t, err)
+	_, err = SortProps([]Prop{a, b})
+	assert.EqualError(t, err, "The property sources form a cycle: $a -> $b -> $a")
+}
+
+func TestParsePropScope(t *testing.T) {
+	p, err := ParseProp("album@parent=(.+)")
+	assert.Nil(t, err)
+	assert.Equal(t, "album", p.Name)
+	assert.Equal(t, PropScopeParent, p.Scope)
+
+	rstate := renamerState{fileName: "01 Intro.mp3", stem: "01 Intro", path: filepath.Join("/music", "Album", "01 Intro.mp3")}
+	assert.Equal(t, "Album", p.sourceValue(rstate, VarValues{}))
+
+	p, err = ParseProp("title@stem=(.+)")
+	assert.Nil(t, err)
+	assert.Equal(t, "01 Intro", p.sourceValue(rstate, VarValues{}))
+
+	p, err = ParseProp("folder@dir=(.+)")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join("/music", "Album"), p.sourceValue(rstate, VarValues{}))
+
+	_, err = ParseProp("album@folder=(.+)")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 6, err.(*ParseError).Pos)
+
+	_, err = ParseProp("word@parent=$title:(\\w+)")
+	assert.IsType(t, &ParseError{}, err)
+}
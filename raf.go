@@ -2,9 +2,13 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // VarValues stores the values parsed from the original name of the file based on the
@@ -25,6 +29,14 @@ const (
 	// file raf has been asked to rename does not exist in the file system. The Value
 	// property of the RenameWarning will be populated with the original file name
 	RenameWarningTypeFileDoesNotExist
+	// RenameWarningTypeInvalidName is used when the generated name is not a valid file name on the
+	// target platform, for example because it contains a / or it is longer than 255 bytes. The Value
+	// property of the RenameWarning will be populated with a description of the problem.
+	RenameWarningTypeInvalidName
+	// RenameWarningTypeInvalidDate is used when the date formatter cannot parse the value of a
+	// property as a date. The value is left unchanged and the Value property of the RenameWarning
+	// will be populated with the reason.
+	RenameWarningTypeInvalidDate
 )
 
 // RenameWarning contains information about potential name generation issues. For example,
@@ -42,6 +54,10 @@ func (w *RenameWarning) String(entry RenameLogEntry) string {
 		return fmt.Sprintf("WARNING: Could not extract property %s from original file name: %s ", w.Value, entry.OriginalFileName)
 	case RenameWarningtypePropertyMissing:
 		return fmt.Sprintf("WARNING: Output file name asks for property %s which is not delcared", w.Value)
+	case RenameWarningTypeInvalidName:
+		return fmt.Sprintf("WARNING: New file name %s %s", entry.NewFileName, w.Value)
+	case RenameWarningTypeInvalidDate:
+		return fmt.Sprintf("WARNING: %s in file %s, the value was left unchanged", w.Value, entry.OriginalFileName)
 	}
 	return ""
 }
@@ -66,58 +82,63 @@ type RenameLogEntry struct {
 type RenameLog = []RenameLogEntry
 
 // RenameAllFiles iterates over the files passed as input and for each one, extracts the
-// property values, populates the intrinsic properties, and calls the GenerateName function.
-// The output RenameLog file can be passed to the Apply() function to perform the changes.
-func RenameAllFiles(p []Prop, tokens TokenStream, files []string, opts Opts) (RenameLog, error) {
-	rlog := make([]RenameLogEntry, len(files))
-	collisions := make(map[string][]int)
-	for idx, f := range files {
-		_, err := filepath.Abs(f)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not determine absolute path for %s: %s\n", f, err)
-			return rlog[:idx], err
-		}
-		//baseDir := filepath.Dir(absPath)
-
-		fileName := filepath.Base(f)
-		state := renamerState{
-			idx:       idx,
-			fileName:  fileName,
-			extension: filepath.Ext(fileName),
-		}
-
-		varValues := extractVarValues(fileName, p, opts)
-		for k, v := range ReservedVarNames {
-			varValues[k] = v(state)
-		}
+// property values, populates the intrinsic properties, computes the vars, and calls the
+// GenerateName function. The output RenameLog file can be passed to the Apply() function to
+// perform the changes.
+func RenameAllFiles(p []Prop, vars []Var, tokens TokenStream, files []string, opts Opts) (RenameLog, error) {
+	jobs, err := prepareRename(p, vars, tokens, files, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		outName, warnings, err := GenerateName(varValues, tokens, state, opts)
+	platform := validationPlatform(opts)
+	rlog := make([]RenameLogEntry, len(jobs))
+	for idx, job := range jobs {
+		outName, nameWarnings, err := GenerateName(job.varValues, tokens, job.state, opts)
 		if err != nil {
 			return rlog[:idx], err
 		}
+		warnings := append(append([]RenameWarning{}, job.warnings...), nameWarnings...)
 
 		if opts.Verbose {
-			fmt.Fprintf(os.Stderr, "Renaming \"%s\" to \"%s\"\n", fileName, outName)
+			fmt.Fprintf(os.Stderr, "Renaming \"%s\" to \"%s\"\n", job.state.fileName, outName)
 		}
-
-		c, ok := collisions[outName]
-		if !ok {
-			collisions[outName] = make([]int, 1)
-			collisions[outName][0] = idx
-		} else {
-			collisions[outName] = append(c, idx)
+		for _, problem := range ValidateName(outName, platform) {
+			warnings = append(warnings, RenameWarning{
+				Type:  RenameWarningTypeInvalidName,
+				Value: problem,
+			})
 		}
 
 		rlog[idx] = RenameLogEntry{
-			OriginalFileName: fileName,
+			OriginalFileName: job.state.fileName,
 			NewFileName:      outName,
 			Warnings:         warnings,
-			// we'll append the collisions at teh end, once we have a fully populated map
+			// we'll append the collisions at the end, once we have a fully populated log
 		}
 	}
 
-	// populate collisions
-	// TODO: Validate output file name
+	markCollisions(rlog, opts.CaseInsensitive)
+	return rlog, nil
+}
+
+// validationPlatform returns the platform the generated names are validated for: the platform they
+// are sanitized for or, when they are not sanitized, the platform raf is running on.
+func validationPlatform(opts Opts) string {
+	if opts.Sanitize == "" || opts.Sanitize == SanitizeNone {
+		return hostPlatform()
+	}
+	return opts.Sanitize
+}
+
+// markCollisions populates the Collisions field of the entries of the log that share the same new name.
+// Names are compared in their normalized form and, if foldCase is true, case-insensitively.
+func markCollisions(rlog RenameLog, foldCase bool) {
+	collisions := make(map[string][]int)
+	for idx, e := range rlog {
+		key := collisionKey(e.NewFileName, foldCase)
+		collisions[key] = append(collisions[key], idx)
+	}
 	for _, v := range collisions {
 		if len(v) > 1 {
 			for _, idx := range v {
@@ -125,56 +146,283 @@ func RenameAllFiles(p []Prop, tokens TokenStream, files []string, opts Opts) (Re
 			}
 		}
 	}
-	return rlog, nil
+}
+
+// renamesOverlap tells whether any entry of the log is renamed to the original name of another entry.
+// Applying these logs in order would overwrite files that were not renamed yet. Names are compared in
+// their normalized form because some file systems treat NFC and NFD names as the same file.
+func renamesOverlap(rlog RenameLog) bool {
+	originals := make(map[string]bool)
+	for _, e := range rlog {
+		originals[collisionKey(e.OriginalFileName, false)] = true
+	}
+	for _, e := range rlog {
+		newKey := collisionKey(e.NewFileName, false)
+		if newKey != collisionKey(e.OriginalFileName, false) && originals[newKey] {
+			return true
+		}
+	}
+	return false
+}
+
+// renameJob contains the renamer state and the variable values extracted for a single file. The
+// values are ready to be passed to the GenerateName function.
+type renameJob struct {
+	state     renamerState
+	varValues VarValues
+	// warnings are the warnings produced while computing the vars
+	warnings []RenameWarning
+}
+
+// prepareRename extracts the property values, populates the intrinsic properties used by the output
+// tokens and the vars, and computes the vars for each of the given files.
+func prepareRename(p []Prop, vars []Var, tokens TokenStream, files []string, opts Opts) ([]renameJob, error) {
+	p, err := SortProps(p)
+	if err != nil {
+		return nil, err
+	}
+	vars, err = SortVars(vars)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	intrinsics := usedIntrinsics(tokens, p, vars)
+	now := time.Now()
+	jobs := make([]renameJob, 0)
+	for _, f := range files {
+		absPath, err := filepath.Abs(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not determine absolute path for %s: %s\n", f, err)
+			return nil, err
+		}
+		relPath, err := filepath.Rel(cwd, absPath)
+		if err != nil {
+			relPath = absPath
+		}
+
+		fileName := filepath.Base(f)
+		stem, ext, fullExt := splitFileName(fileName, opts.CompoundExtensions)
+		state := renamerState{
+			idx:           len(jobs),
+			fileName:      fileName,
+			stem:          stem,
+			extension:     ext,
+			fullExtension: fullExt,
+			path:          absPath,
+			relPath:       relPath,
+			meta:          newFileMeta(absPath),
+			now:           now,
+		}
+
+		varValues, err := extractVarValues(state, p, opts)
+		if err != nil {
+			var notMatched *PropNotMatchedError
+			if errors.As(err, &notMatched) && notMatched.Prop.Required == PropRequiredSkip {
+				fmt.Fprintf(os.Stderr, "Skipping: %s\n", err)
+				continue
+			}
+			return nil, err
+		}
+		jobs = append(jobs, renameJob{
+			state:     state,
+			varValues: varValues,
+		})
+	}
+
+	// the counter follows the sort order
+	err = sortJobs(jobs, opts.Sort, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+
+	// intrinsics such as $total depend on the files that were not skipped
+	for idx := range jobs {
+		jobs[idx].state.total = len(jobs)
+		for k := range intrinsics {
+			jobs[idx].varValues[k] = ReservedVarNames[k](jobs[idx].state)
+		}
+		if jobs[idx].state.meta.err != nil {
+			return nil, fmt.Errorf("Could not read the metadata of %s: %v", jobs[idx].state.path, jobs[idx].state.meta.err)
+		}
+	}
+	err = computeCounters(jobs, tokens, vars, opts)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range jobs {
+		jobs[idx].warnings, err = computeVars(vars, jobs[idx].varValues, jobs[idx].state, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
 }
 
 // GenerateName uses the variable values to generate a string based on the input TokenStream
 func GenerateName(varValues VarValues, out TokenStream, rstate renamerState, opts Opts) (string, []RenameWarning, error) {
+	return generateName(varValues, out, rstate, opts, nil)
+}
+
+// tokenTrace records how GenerateName rendered a single token of the output. The explain command
+// uses traces to show the value of a property at each step of its formatting pipeline.
+type tokenTrace struct {
+	Token Token
+	// Value is the literal string or the value of the property before formatting
+	Value string
+	// Steps contains the output of each formatter in the token's pipeline
+	Steps []string
+	// Output is the string appended to the generated name
+	Output   string
+	Warnings []RenameWarning
+}
+
+// generateName is the implementation of GenerateName. If traces is not nil, the function appends
+// a tokenTrace for each token in the output.
+func generateName(varValues VarValues, out TokenStream, rstate renamerState, opts Opts, traces *[]tokenTrace) (string, []RenameWarning, error) {
+	outName, warnings, err := renderTokens(varValues, out, rstate, opts, traces)
+	if err != nil {
+		return "", warnings, err
+	}
+	if opts.ASCII {
+		outName = Transliterate(outName, DefaultTransliterationReplacement)
+	}
+	outName = normalizeName(outName, opts.Normalize)
+	outName = SanitizeName(outName, opts.Sanitize, opts.CompoundExtensions)
+	return outName, warnings, nil
+}
+
+// renderTokens concatenates the literals and the formatted values of the tokens. Unlike generateName
+// it does not transliterate, normalize, or sanitize the result, so it can render parts of a name such
+// as the template of a var.
+func renderTokens(varValues VarValues, out TokenStream, rstate renamerState, opts Opts, traces *[]tokenTrace) (string, []RenameWarning, error) {
 	outName := ""
 	warnings := make([]RenameWarning, 0)
 	for _, t := range out {
+		trace := tokenTrace{Token: t}
 		if t.Type == TokenTypeLiteral {
 			outName += t.Value
-			continue
+			trace.Value = t.Value
+			trace.Output = t.Value
+		}
+		if t.Type == TokenTypeProperty || t.Type == TokenTypeGroup {
+			render := renderProperty
+			if t.Type == TokenTypeGroup {
+				render = renderGroup
+			}
+			propValue, propWarnings, err := render(t, varValues, rstate, opts, &trace)
+			if err != nil {
+				return "", warnings, err
+			}
+			warnings = append(warnings, propWarnings...)
+			outName += propValue
+			trace.Output = propValue
+			trace.Warnings = propWarnings
+		}
+		if traces != nil {
+			*traces = append(*traces, trace)
 		}
-		if t.Type == TokenTypeProperty {
+	}
+	return outName, warnings, nil
+}
+
+// renderGroup renders the first alternative of a group token whose properties all have a value, or
+// its fallback if none of them do. Groups without a fallback render an empty string without warnings,
+// so that optional segments such as ${ - $subtitle} do not leave gaps in the name.
+func renderGroup(t Token, varValues VarValues, rstate renamerState, opts Opts, trace *tokenTrace) (string, []RenameWarning, error) {
+	chosen := t.Fallback
+	for _, alt := range t.Alternatives {
+		if hasValues(alt, varValues) {
+			chosen = alt
+			break
+		}
+	}
+	value, warnings, err := renderTokens(varValues, chosen, rstate, opts, nil)
+	if err != nil {
+		return "", warnings, err
+	}
+	trace.Value = value
+	formattedValue, formatWarnings, err := applyFormatters(value, t.Formatter, rstate, trace)
+	return formattedValue, append(warnings, formatWarnings...), err
+}
 
-			propValue, ok := varValues[t.Value]
-			if !ok {
-				fmt.Fprintf(os.Stderr, "WARNING: Output asks for value %s that is not declared as a property\n", t.Value)
-				warnings = append(warnings, RenameWarning{
-					Type:  RenameWarningtypePropertyMissing,
-					Value: t.Value,
-				})
+// hasValues tells whether all of the properties of the token stream have a value that is not empty.
+// Groups nested in the stream have a value if they declare a fallback or if one of their alternatives
+// has a value.
+func hasValues(tokens TokenStream, varValues VarValues) bool {
+	for _, t := range tokens {
+		switch t.Type {
+		case TokenTypeProperty:
+			if varValues[counterKey(t)] == "" {
+				return false
+			}
+		case TokenTypeGroup:
+			if t.Fallback != nil {
 				continue
 			}
-
-			if propValue == "" {
-				if opts.Verbose {
-					fmt.Fprintf(os.Stderr, "WARNING: Value for property %s is empty\n", t.Value)
-				}
-				warnings = append(warnings, RenameWarning{
-					Type:  RenameWarningTypePropertyValueEmpty,
-					Value: t.Value,
-				})
+			found := false
+			for _, alt := range t.Alternatives {
+				found = found || hasValues(alt, varValues)
 			}
-
-			if t.Formatter != nil {
-				formattedValue := propValue
-				for _, f := range t.Formatter {
-					fout, err := f.Format(formattedValue, rstate)
-					if err != nil {
-						return "", warnings, err
-					}
-					formattedValue = fout
-				}
-				outName += formattedValue
-			} else {
-				outName += propValue
+			if !found {
+				return false
 			}
 		}
 	}
-	return outName, warnings, nil
+	return true
+}
+
+// renderProperty looks up the value of a property token and runs it through the token's formatting
+// pipeline
+func renderProperty(t Token, varValues VarValues, rstate renamerState, opts Opts, trace *tokenTrace) (string, []RenameWarning, error) {
+	warnings := make([]RenameWarning, 0)
+	propValue, ok := varValues[counterKey(t)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "WARNING: Output asks for value %s that is not declared as a property\n", t.Value)
+		warnings = append(warnings, RenameWarning{
+			Type:  RenameWarningtypePropertyMissing,
+			Value: t.Value,
+		})
+		return "", warnings, nil
+	}
+	trace.Value = propValue
+
+	if propValue == "" {
+		if opts.Verbose {
+			fmt.Fprintf(os.Stderr, "WARNING: Value for property %s is empty\n", t.Value)
+		}
+		warnings = append(warnings, RenameWarning{
+			Type:  RenameWarningTypePropertyValueEmpty,
+			Value: t.Value,
+		})
+	}
+
+	formattedValue, formatWarnings, err := applyFormatters(propValue, t.Formatter, rstate, trace)
+	return formattedValue, append(warnings, formatWarnings...), err
+}
+
+// applyFormatters runs the value through the formatting pipeline and records each step in the trace.
+// Values the date formatter cannot parse are passed on unchanged and reported as warnings.
+func applyFormatters(value string, pipeline FormattingPipeline, rstate renamerState, trace *tokenTrace) (string, []RenameWarning, error) {
+	warnings := make([]RenameWarning, 0)
+	formattedValue := value
+	for _, f := range pipeline {
+		fout, err := f.Format(formattedValue, rstate)
+		var dateErr *DateParseError
+		if errors.As(err, &dateErr) {
+			warnings = append(warnings, RenameWarning{
+				Type:  RenameWarningTypeInvalidDate,
+				Value: dateErr.Error(),
+			})
+		} else if err != nil {
+			return "", warnings, err
+		}
+		formattedValue = fout
+		trace.Steps = append(trace.Steps, formattedValue)
+	}
+	return formattedValue, warnings, nil
 }
 
 // Undo looks for a rename log file in the given folder and reverses the change to the files listed in the log.
@@ -206,42 +454,42 @@ func Undo(cwd string, opts Opts) (RenameLog, error) {
 		fmt.Fprintf(os.Stderr, "Beginning raf undo in folder %s", abs)
 	}
 
-	flipRlog := make([]RenameLogEntry, len(rlog))
-	collisions := make(map[string][]int)
-	for idx, entry := range rlog {
-		warnings := make([]RenameWarning, 0)
+	// entries whose renamed file is missing are dropped from the undo log
+	found := make(RenameLog, 0, len(rlog))
+	for _, entry := range rlog {
 		curFilePath := abs + string(os.PathSeparator) + entry.NewFileName
-		newFilePath := abs + string(os.PathSeparator) + entry.OriginalFileName
-		// new file must exists
 		if _, err = os.Stat(curFilePath); os.IsNotExist(err) {
 			if opts.Verbose {
-				fmt.Fprintf(os.Stderr, "WARNING: File %s from raf log not found", entry.NewFileName)
+				fmt.Fprintf(os.Stderr, "WARNING: File %s from raf log not found\n", entry.NewFileName)
 			}
-			warnings = append(warnings, RenameWarning{
-				Type:  RenameWarningTypeFileDoesNotExist,
-				Value: entry.NewFileName,
-			})
-			continue
-		}
-		// original file must not
-		if _, err = os.Stat(newFilePath); !os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "WARNING: Another file is already using the name %s preventing raf from resting %s to its original name", entry.OriginalFileName, entry.NewFileName)
 			continue
 		}
+		found = append(found, entry)
+	}
+	// names that are vacated by the undo itself, such as the numbers of a resequenced sequence, can be
+	// reused: Apply moves overlapping names through temporary names
+	vacated := make(map[string]bool)
+	for _, entry := range found {
+		vacated[collisionKey(entry.NewFileName, false)] = true
+	}
 
-		c, ok := collisions[entry.OriginalFileName]
-		if !ok {
-			collisions[entry.OriginalFileName] = make([]int, 1)
-			collisions[entry.OriginalFileName][0] = idx
-		} else {
-			collisions[entry.OriginalFileName] = append(c, idx)
+	flipRlog := make([]RenameLogEntry, 0, len(found))
+	collisions := make(map[string][]int)
+	for _, entry := range found {
+		// original file must not exist, unless it is renamed by the undo too
+		newFilePath := abs + string(os.PathSeparator) + entry.OriginalFileName
+		if _, err = os.Stat(newFilePath); !os.IsNotExist(err) && !vacated[collisionKey(entry.OriginalFileName, false)] {
+			fmt.Fprintf(os.Stderr, "WARNING: Another file is already using the name %s preventing raf from resetting %s to its original name\n", entry.OriginalFileName, entry.NewFileName)
+			continue
 		}
 
-		flipRlog[idx] = RenameLogEntry{
+		key := collisionKey(entry.OriginalFileName, opts.CaseInsensitive)
+		collisions[key] = append(collisions[key], len(flipRlog))
+		flipRlog = append(flipRlog, RenameLogEntry{
 			OriginalFileName: entry.NewFileName,
 			NewFileName:      entry.OriginalFileName,
-			Warnings:         warnings,
-		}
+			Warnings:         make([]RenameWarning, 0),
+		})
 	}
 
 	// populate collisions
@@ -272,6 +520,10 @@ func Apply(rlog RenameLog, path string, opts Opts) error {
 		return fmt.Errorf("The given path %s is not a directory", path)
 	}
 
+	if renamesOverlap(rlog) {
+		return applyInTwoPhases(rlog, absPath)
+	}
+
 	for idx, e := range rlog {
 		origFile := absPath + string(os.PathSeparator) + e.OriginalFileName
 		newFile := absPath + string(os.PathSeparator) + e.NewFileName
@@ -290,6 +542,64 @@ func Apply(rlog RenameLog, path string, opts Opts) error {
 	return writeRenameLog(rlog, absPath)
 }
 
+// applyInTwoPhases renames the files in the log when the new names overlap with the original names,
+// for example when two files swap names or a sequence is shifted. All files are first moved to a
+// temporary name and then to their new name. If a rename fails, the files already moved to their new
+// name are moved back to their temporary name, in reverse order, and all of the files are restored to
+// their original name. The rollback never overwrites an existing file.
+func applyInTwoPhases(rlog RenameLog, absPath string) error {
+	tmpNames := make([]string, len(rlog))
+	for idx, e := range rlog {
+		origFile := absPath + string(os.PathSeparator) + e.OriginalFileName
+		tmpNames[idx] = absPath + string(os.PathSeparator) + fmt.Sprintf(".raf-%d-%d.tmp", os.Getpid(), idx)
+		err := os.Rename(origFile, tmpNames[idx])
+		if err != nil {
+			for restore := idx - 1; restore >= 0; restore-- {
+				restoreTemp(tmpNames[restore], absPath, rlog[restore])
+			}
+			return err
+		}
+	}
+
+	for idx, e := range rlog {
+		newFile := absPath + string(os.PathSeparator) + e.NewFileName
+		err := os.Rename(tmpNames[idx], newFile)
+		if err != nil {
+			for undo := idx - 1; undo >= 0; undo-- {
+				undoFile := absPath + string(os.PathSeparator) + rlog[undo].NewFileName
+				if undoErr := renameIfAbsent(undoFile, tmpNames[undo]); undoErr != nil {
+					fmt.Fprintf(os.Stderr, "FATAL: Could not move %s back to %s: %s\n", rlog[undo].NewFileName, tmpNames[undo], undoErr)
+				}
+			}
+			for restore := range rlog {
+				restoreTemp(tmpNames[restore], absPath, rlog[restore])
+			}
+			return err
+		}
+		fmt.Println(e.NewFileName)
+	}
+	return writeRenameLog(rlog, absPath)
+}
+
+// restoreTemp moves a file from its temporary name back to its original name
+func restoreTemp(tmpFile, absPath string, e RenameLogEntry) {
+	origFile := absPath + string(os.PathSeparator) + e.OriginalFileName
+	if err := renameIfAbsent(tmpFile, origFile); err != nil {
+		fmt.Fprintf(os.Stderr, "FATAL: Could not restore %s from %s: %s\n", e.OriginalFileName, tmpFile, err)
+	}
+}
+
+// renameIfAbsent renames a file like os.Rename, but returns an error instead of replacing the
+// destination if it already exists
+func renameIfAbsent(from, to string) error {
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
 // ReadRenameLog parses a RenameLog file at the given path and unmarshals it into a
 // RenameLog object (slice of RenameLogEntry)
 func ReadRenameLog(path string) (RenameLog, error) {
@@ -309,29 +619,113 @@ func ReadRenameLog(path string) (RenameLog, error) {
 }
 
 type renamerState struct {
-	idx       int
-	fileName  string
+	idx      int
+	fileName string
+	// stem is the file name without its full extension
+	stem      string
 	extension string
+	// fullExtension is the extension including known compound extensions such as .tar.gz
+	fullExtension string
+	// path is the absolute path of the file
+	path string
+	// relPath is the path of the file relative to the working directory
+	relPath string
+	// meta loads the metadata of the file used by intrinsics such as $size
+	meta *fileMeta
+	// now is the time raf started renaming the files
+	now time.Time
+	// total is the number of files renamed
+	total int
 }
 
-func extractVarValues(fname string, p []Prop, opts Opts) VarValues {
+// extractVarValues runs the regex of each prop against its scope - the file name by default - or its
+// source variable, and returns the values of the variables defined by the props. The props must be sorted with SortProps.
+// If a required prop does not match the file name, the function returns a PropNotMatchedError.
+func extractVarValues(rstate renamerState, p []Prop, opts Opts) (VarValues, error) {
+	fname := rstate.fileName
 	varValues := make(map[string]string)
 	for _, prop := range p {
-		matches := prop.Regex.FindAllStringSubmatch(fname, -1) //prop.Regex.FindAllString(fname, -1)
-		if matches == nil {
+		matches := prop.Regex.FindAllStringSubmatch(prop.sourceValue(rstate, varValues), -1) //prop.Regex.FindAllString(fname, -1)
+		match := selectMatch(prop, matches)
+		if match == nil {
+			if prop.Required != PropOptional {
+				return varValues, &PropNotMatchedError{Prop: prop, FileName: fname}
+			}
 			if opts.Verbose {
 				fmt.Fprintf(os.Stderr, "WARNING: the matcher %s does not match any string on file %s\n", prop.Matcher, fname)
 			}
-			varValues["$"+prop.Name] = ""
+			for _, name := range prop.VarNames() {
+				varValues[name] = ""
+			}
+			varValues["$"+prop.Name] = prop.Default
 			continue
 		}
-		if len(matches) > 1 && opts.Verbose {
+		if len(matches) > 1 && prop.Match == PropMatchFirst && opts.Verbose {
 			fmt.Fprintf(os.Stderr, "WARNING: the matcher %s matches multiple parts on file %s, only the leftmost is available\n", prop.Matcher, fname)
 		}
-		varValues["$"+prop.Name] = matches[0][len(matches[0])-1]
+		setMatchValues(varValues, prop, match)
 	}
 
-	return varValues
+	return varValues, nil
+}
+
+// selectMatch picks the match configured in the Match field of the prop. When the prop collects all
+// matches, each group of the returned match contains the values of the same group in all matches
+// joined by the prop separator. If the requested match does not exist the function returns nil.
+func selectMatch(prop Prop, matches [][]string) []string {
+	if len(matches) == 0 {
+		return nil
+	}
+	switch prop.Match {
+	case PropMatchAll:
+		joined := make([]string, len(matches[0]))
+		for idx := range joined {
+			values := make([]string, len(matches))
+			for midx, m := range matches {
+				values[midx] = m[idx]
+			}
+			joined[idx] = strings.Join(values, prop.Separator)
+		}
+		return joined
+	}
+	idx := selectedMatch(prop, len(matches))
+	if idx < 0 {
+		return nil
+	}
+	return matches[idx]
+}
+
+// selectedMatch returns the index of the match selected by the prop among the given number of matches,
+// or -1 if the prop asks for a match that does not exist. Props that collect all matches are not
+// supported.
+func selectedMatch(prop Prop, count int) int {
+	switch prop.Match {
+	case PropMatchLast:
+		return count - 1
+	case PropMatchFirst:
+		if count == 0 {
+			return -1
+		}
+		return 0
+	default:
+		if prop.Match > count {
+			return -1
+		}
+		return prop.Match - 1
+	}
+}
+
+// setMatchValues populates the variables defined by the prop with the groups of a single match: the
+// last group is assigned to the prop name, each group is assigned to its number, and named groups
+// are assigned to their name
+func setMatchValues(varValues VarValues, prop Prop, match []string) {
+	varValues["$"+prop.Name] = match[len(match)-1]
+	for idx, group := range prop.Regex.SubexpNames() {
+		varValues["$"+prop.Name+"."+strconv.Itoa(idx)] = match[idx]
+		if group != "" {
+			varValues["$"+group] = match[idx]
+		}
+	}
 }
 
 func writeRenameLog(rlog RenameLog, absPath string) error {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,11 +18,22 @@ func mockState(cnt int) renamerState {
 	}
 }
 
+func fileState(name string) renamerState {
+	stem, ext, fullExt := splitFileName(name, DefaultCompoundExtensions)
+	return renamerState{
+		fileName:      name,
+		stem:          stem,
+		extension:     ext,
+		fullExtension: fullExt,
+		path:          filepath.Join(os.TempDir(), name),
+	}
+}
+
 func TestExtractPropGroup(t *testing.T) {
 	p, err := NewProp("title", titlePropRegexGroup)
 	assert.Nil(t, err)
 
-	vals := extractVarValues("wedding - chapel first - video01", []Prop{p}, Opts{})
+	vals, err := extractVarValues(fileState("wedding - chapel first - video01"), []Prop{p}, Opts{})
 	assert.NotNil(t, vals)
 	title, ok := vals["$title"]
 	assert.True(t, ok)
@@ -31,7 +44,7 @@ func TestExtractProp(t *testing.T) {
 	p, err := NewProp("title", "\\ \\-\\ [A-Za-z0-9\\ ]+\\ \\-")
 	assert.Nil(t, err)
 
-	vals := extractVarValues("wedding - chapel first - video01", []Prop{p}, Opts{})
+	vals, err := extractVarValues(fileState("wedding - chapel first - video01"), []Prop{p}, Opts{})
 	assert.NotNil(t, vals)
 	title, ok := vals["$title"]
 	assert.True(t, ok)
@@ -42,7 +55,7 @@ func TestExtractPropNoMatch(t *testing.T) {
 	p, err := NewProp("title", titlePropRegexGroup)
 	assert.Nil(t, err)
 
-	vals := extractVarValues("wedding_chapel first - video01", []Prop{p}, Opts{})
+	vals, err := extractVarValues(fileState("wedding_chapel first - video01"), []Prop{p}, Opts{})
 	assert.NotNil(t, vals)
 	title, ok := vals["$title"]
 	assert.True(t, ok)
@@ -75,6 +88,60 @@ func TestRenameStringMissingProperty(t *testing.T) {
 	assert.Equal(t, "rip - .mkv", renamed)
 }
 
+func TestRenameGroups(t *testing.T) {
+	out, err := ParseOutput("$show - ${title:-Untitled}${ - $subtitle}.mkv")
+	assert.Nil(t, err)
+
+	values := VarValues{"$show": "Show", "$title": "Pilot", "$subtitle": "Part 1"}
+	renamed, warn, err := GenerateName(values, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Empty(t, warn)
+	assert.Equal(t, "Show - Pilot - Part 1.mkv", renamed)
+
+	values = VarValues{"$show": "Show", "$title": "", "$subtitle": ""}
+	renamed, warn, err = GenerateName(values, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Empty(t, warn)
+	assert.Equal(t, "Show - Untitled.mkv", renamed)
+}
+
+func TestRenameGroupAlternatives(t *testing.T) {
+	out, err := ParseOutput("${title|episode[%03]|fname:-unknown}[^upper]")
+	assert.Nil(t, err)
+
+	renamed, _, err := GenerateName(VarValues{"$title": "", "$episode": "7", "$fname": "a.mkv"}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "007", renamed)
+
+	renamed, _, err = GenerateName(VarValues{"$title": "", "$episode": "", "$fname": "a.mkv"}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "A.MKV", renamed)
+
+	renamed, _, err = GenerateName(VarValues{"$title": "", "$episode": "", "$fname": ""}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "UNKNOWN", renamed)
+
+	// without a fallback an empty group leaves no gap and no warning, nested groups without a value
+	// hide the segment around them
+	out, err = ParseOutput("Show${ - ${title|episode}}.mkv")
+	assert.Nil(t, err)
+	renamed, warn, err := GenerateName(VarValues{"$title": "", "$episode": ""}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Empty(t, warn)
+	assert.Equal(t, "Show.mkv", renamed)
+
+	renamed, _, err = GenerateName(VarValues{"$title": "", "$episode": "3"}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Show - 3.mkv", renamed)
+
+	out, err = ParseOutput("Show${ - $title}.mkv")
+	assert.Nil(t, err)
+	renamed, warn, err = GenerateName(VarValues{"$title": ""}, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Empty(t, warn)
+	assert.Equal(t, "Show.mkv", renamed)
+}
+
 func TestRenamePaddingFormatter(t *testing.T) {
 	values := make(map[string]string)
 	values["$title"] = "test title"
@@ -86,3 +153,147 @@ func TestRenamePaddingFormatter(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "rip - 001 - test title.mkv", renamed)
 }
+
+func TestExtractNamedGroups(t *testing.T) {
+	p, err := ParseProp("re=(?P<show>.+)\\.S(?P<season>\\d+)E(?P<ep>\\d+)")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$re", "$re.0", "$re.1", "$show", "$re.2", "$season", "$re.3", "$ep"}, p.VarNames())
+
+	vals, err := extractVarValues(fileState("The.Show.S01E05.mkv"), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "The.Show", vals["$show"])
+	assert.Equal(t, "01", vals["$season"])
+	assert.Equal(t, "05", vals["$ep"])
+	assert.Equal(t, "05", vals["$re"])
+	assert.Equal(t, "The.Show.S01E05", vals["$re.0"])
+	assert.Equal(t, "01", vals["$re.2"])
+
+	vals, err = extractVarValues(fileState("no match.mkv"), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", vals["$show"])
+	assert.Equal(t, "", vals["$re.3"])
+
+	out, err := ParseOutput("$show[/\\./ /] - $re.2x$ep$ext")
+	assert.Nil(t, err)
+	assert.Equal(t, "$re.2", out[2].Value)
+	vals, err = extractVarValues(fileState("The.Show.S01E05.mkv"), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	vals["$ext"] = ".mkv"
+	renamed, _, err := GenerateName(vals, out, mockState(0), Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "The Show - 01x05.mkv", renamed)
+}
+
+func TestExtractMatchModes(t *testing.T) {
+	fname := "Show [720p] [AAC] [x264].mkv"
+	p, err := ParseProp("tag=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err := extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "720p", vals["$tag"])
+
+	p, err = ParseProp("tag{match=last}=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "x264", vals["$tag"])
+
+	p, err = ParseProp("tag{match=2}=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "AAC", vals["$tag"])
+
+	p, err = ParseProp("tag{match=4}=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", vals["$tag"])
+
+	p, err = ParseProp("tags{match=all}=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "720p,AAC,x264", vals["$tags"])
+	assert.Equal(t, "[720p],[AAC],[x264]", vals["$tags.0"])
+
+	p, err = ParseProp("tags{match=all,sep=\\,\\ }=\\[(\\w+)\\]")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState(fname), []Prop{p}, Opts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "720p, AAC, x264", vals["$tags"])
+}
+
+func TestExtractDefaultAndRequired(t *testing.T) {
+	p, err := ParseProp("title{default=Untitled}=\\d - ([a-z]+)")
+	assert.Nil(t, err)
+	vals, err := extractVarValues(fileState("video 1 - _home.mkv"), []Prop{p}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Untitled", vals["$title"])
+
+	p, err = ParseProp("title!=\\d - ([a-z]+)")
+	assert.Nil(t, err)
+	_, err = extractVarValues(fileState("video 1 - _home.mkv"), []Prop{p}, Opts{})
+	assert.IsType(t, &PropNotMatchedError{}, err)
+
+	// anchored props match the whole stem
+	p, err = ParseProp("ep=/(\\d+)/a")
+	assert.Nil(t, err)
+	vals, err = extractVarValues(fileState("12.mkv"), []Prop{p}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "12", vals["$ep"])
+	vals, err = extractVarValues(fileState("ep 12.mkv"), []Prop{p}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", vals["$ep"])
+}
+
+func TestRenameSkipsFilesWithoutRequiredProp(t *testing.T) {
+	p, err := ParseProp("title{required=skip}=\\d - ([a-z]+)")
+	assert.Nil(t, err)
+	out, err := ParseOutput("$cnt - $title$ext")
+	assert.Nil(t, err)
+
+	rlog, err := RenameAllFiles([]Prop{p}, nil, out, []string{"1 - home.mkv", "2 - _church.mkv", "3 - party.mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rlog))
+	assert.Equal(t, "1 - home.mkv", rlog[0].NewFileName)
+	assert.Equal(t, "2 - party.mkv", rlog[1].NewFileName)
+
+	p.Required = PropRequiredFail
+	_, err = RenameAllFiles([]Prop{p}, nil, out, []string{"1 - home.mkv", "2 - _church.mkv"}, Opts{})
+	assert.NotNil(t, err)
+}
+
+func TestExtractChainedProps(t *testing.T) {
+	letter, err := ParseProp("letter=$word:^(\\w)")
+	assert.Nil(t, err)
+	word, err := ParseProp("word=$title:^(\\w+)")
+	assert.Nil(t, err)
+	title, err := ParseProp("title=\\d+ - (.+)\\.")
+	assert.Nil(t, err)
+
+	out, err := ParseOutput("$letter - $word$ext")
+	assert.Nil(t, err)
+	rlog, err := RenameAllFiles([]Prop{letter, word, title}, nil, out, []string{"1 - wedding video.mkv", "2 - .mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "w - wedding.mkv", rlog[0].NewFileName)
+	assert.Equal(t, " - .mkv", rlog[1].NewFileName)
+}
+
+func TestPathIntrinsics(t *testing.T) {
+	rstate := renamerState{
+		fileName: "01 Intro.mp3",
+		path:     filepath.Join("/music", "Album", "01 Intro.mp3"),
+		relPath:  filepath.Join("Album", "01 Intro.mp3"),
+	}
+	out, err := ParseOutput("$parent - $relpath")
+	assert.Nil(t, err)
+	vals := VarValues{}
+	for k, v := range ReservedVarNames {
+		vals[k] = v(rstate)
+	}
+	renamed, _, err := GenerateName(vals, out, rstate, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Album - "+filepath.Join("Album", "01 Intro.mp3"), renamed)
+	assert.Equal(t, filepath.Join("/music", "Album"), ReservedVarNames["$dir"](rstate))
+}
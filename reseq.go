@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reseqPropName is the name of the prop used to find the numeric field when the reseq command is not
+// given a prop
+const reseqPropName = "seq"
+
+// reseqAutoMatcher matches the last number in the stem of a file name: img_0003.jpg
+const reseqAutoMatcher = "(\\d+)\\D*$"
+
+// ReseqOpts configures the Resequence function
+type ReseqOpts struct {
+	// Start is the first number of the new sequence
+	Start int
+	// Offset shifts the existing numbers instead of renumbering them when HasOffset is set
+	Offset    int
+	HasOffset bool
+	// Width zero-pads the numbers to the given number of digits. When it is 0, the numbers keep the
+	// width of the existing field
+	Width int
+}
+
+// reseqEntry is a file whose name contains the numeric field of the sequence
+type reseqEntry struct {
+	fileName string
+	// dir is the folder containing the file
+	dir   string
+	value int
+	// start and end are the byte offsets of the numeric field in the file name
+	start int
+	end   int
+}
+
+// NewReseqProp returns the prop used to find the numeric field of the sequence in the file names. If
+// the definition is empty the prop matches the last number in the stem of the name.
+func NewReseqProp(definition string) (Prop, error) {
+	if definition == "" {
+		p, err := NewProp(reseqPropName, reseqAutoMatcher)
+		if err != nil {
+			return Prop{}, err
+		}
+		p.Scope = PropScopeStem
+		return p, nil
+	}
+	p, err := ParseProp(definition)
+	if err != nil {
+		return Prop{}, err
+	}
+	if p.Source != "" || (p.Scope != "" && p.Scope != PropScopeName && p.Scope != PropScopeStem) {
+		return Prop{}, fmt.Errorf("The reseq property must run against the file name, it cannot declare a source variable or the %s scope", p.Scope)
+	}
+	if p.Match == PropMatchAll {
+		return Prop{}, fmt.Errorf("The reseq property must select a single number, it cannot use match=all")
+	}
+	return p, nil
+}
+
+// Resequence finds the numeric field selected by the prop in each file name, sorts the files by its
+// value, and generates a RenameLog that renumbers them from the start number, or shifts them by the
+// offset. Files whose name does not contain the field are skipped. The function returns the ranges of
+// numbers missing from the original sequence along with the log.
+func Resequence(p Prop, files []string, opts ReseqOpts) (RenameLog, []numberRange, error) {
+	entries := make([]reseqEntry, 0, len(files))
+	fieldWidth := 0
+	for _, f := range files {
+		fileName := filepath.Base(f)
+		entry, ok := findSequenceNumber(p, fileName)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Skipping: %s does not contain a number matching %s\n", fileName, p.Matcher)
+			continue
+		}
+		entry.dir = filepath.Dir(f)
+		if entry.end-entry.start > fieldWidth {
+			fieldWidth = entry.end - entry.start
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("None of the files contain a number matching %s", p.Matcher)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].value < entries[j].value
+	})
+	missing := missingRanges(entries)
+
+	values := make([]int, len(entries))
+	for idx, e := range entries {
+		values[idx] = opts.Start + idx
+		if opts.HasOffset {
+			values[idx] = e.value + opts.Offset
+		}
+		if values[idx] < 0 {
+			return nil, nil, fmt.Errorf("Shifting %s by %d results in a negative number", e.fileName, opts.Offset)
+		}
+	}
+	width := opts.Width
+	if width == 0 {
+		width = fieldWidth
+	}
+
+	resequenced := make(map[string]bool)
+	for _, e := range entries {
+		resequenced[filepath.Join(e.dir, e.fileName)] = true
+	}
+	rlog := make(RenameLog, len(entries))
+	for idx, e := range entries {
+		number := fmt.Sprintf("%0*d", width, values[idx])
+		newName := e.fileName[:e.start] + number + e.fileName[e.end:]
+		// files outside of the sequence are never overwritten
+		target := filepath.Join(e.dir, newName)
+		if _, err := os.Lstat(target); err == nil && !resequenced[target] {
+			return nil, nil, fmt.Errorf("Could not resequence %s, the file %s already exists and is not part of the sequence", e.fileName, newName)
+		}
+		rlog[idx] = RenameLogEntry{
+			OriginalFileName: e.fileName,
+			NewFileName:      newName,
+		}
+	}
+	markCollisions(rlog, false)
+	return rlog, missing, nil
+}
+
+// findSequenceNumber runs the prop regex against the file name and returns the position and the value
+// of the last capture group of the match selected by the prop, or of the entire match if the regex has
+// no groups
+func findSequenceNumber(p Prop, fileName string) (reseqEntry, bool) {
+	rstate := renamerState{fileName: fileName}
+	rstate.stem, rstate.extension, rstate.fullExtension = splitFileName(fileName, nil)
+	matches := p.Regex.FindAllStringSubmatchIndex(p.sourceValue(rstate, nil), -1)
+	selected := selectedMatch(p, len(matches))
+	if selected < 0 {
+		return reseqEntry{}, false
+	}
+	m := matches[selected]
+	start, end := m[len(m)-2], m[len(m)-1]
+	if start < 0 {
+		return reseqEntry{}, false
+	}
+	value, err := strconv.Atoi(fileName[start:end])
+	if err != nil {
+		return reseqEntry{}, false
+	}
+	return reseqEntry{
+		fileName: fileName,
+		value:    value,
+		start:    start,
+		end:      end,
+	}, true
+}
+
+// numberRange is a run of consecutive numbers: the first number and how many numbers it contains
+type numberRange struct {
+	start  int
+	length int
+}
+
+// missingRanges returns the gaps between the lowest and the highest value of the sorted entries. Gaps
+// are returned as ranges so that a few files with far apart numbers do not allocate every number in
+// between.
+func missingRanges(entries []reseqEntry) []numberRange {
+	missing := make([]numberRange, 0)
+	for idx := 1; idx < len(entries); idx++ {
+		if gap := entries[idx].value - entries[idx-1].value - 1; gap > 0 {
+			missing = append(missing, numberRange{start: entries[idx-1].value + 1, length: gap})
+		}
+	}
+	return missing
+}
+
+// formatRanges formats a list of ranges: 4-6, 8, 10-11
+func formatRanges(ranges []numberRange) string {
+	out := make([]string, len(ranges))
+	for idx, r := range ranges {
+		out[idx] = strconv.Itoa(r.start)
+		if r.length > 1 {
+			out[idx] += "-" + strconv.Itoa(r.start+r.length-1)
+		}
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResequence(t *testing.T) {
+	p, err := NewReseqProp("")
+	assert.Nil(t, err)
+	rlog, missing, err := Resequence(p, []string{"img_0012.jpg", "img_0003.jpg", "img_0007.jpg", "cover.jpg"}, ReseqOpts{Start: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rlog))
+	assert.Equal(t, "img_0003.jpg", rlog[0].OriginalFileName)
+	assert.Equal(t, "img_0001.jpg", rlog[0].NewFileName)
+	assert.Equal(t, "img_0002.jpg", rlog[1].NewFileName)
+	assert.Equal(t, "img_0012.jpg", rlog[2].OriginalFileName)
+	assert.Equal(t, "img_0003.jpg", rlog[2].NewFileName)
+	assert.Equal(t, "4-6, 8-11", formatRanges(missing))
+}
+
+func TestResequenceOffsetAndProp(t *testing.T) {
+	p, err := NewReseqProp("num=ep(\\d+)")
+	assert.Nil(t, err)
+	rlog, missing, err := Resequence(p, []string{"ep1 part2.mkv", "ep2 part1.mkv"}, ReseqOpts{Offset: 10, HasOffset: true, Width: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(missing))
+	assert.Equal(t, "ep011 part2.mkv", rlog[0].NewFileName)
+	assert.Equal(t, "ep012 part1.mkv", rlog[1].NewFileName)
+
+	_, _, err = Resequence(p, []string{"ep1.mkv"}, ReseqOpts{Offset: -2, HasOffset: true})
+	assert.NotNil(t, err)
+
+	_, err = NewReseqProp("num@parent=(\\d+)")
+	assert.NotNil(t, err)
+}
+
+func TestApplyOverlappingNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-reseq")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"img_2.jpg", "img_3.jpg"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	rlog := RenameLog{
+		{OriginalFileName: "img_2.jpg", NewFileName: "img_3.jpg"},
+		{OriginalFileName: "img_3.jpg", NewFileName: "img_4.jpg"},
+	}
+	assert.True(t, renamesOverlap(rlog))
+	assert.Nil(t, Apply(rlog, dir, Opts{}))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "img_3.jpg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "img_2.jpg", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(dir, "img_4.jpg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "img_3.jpg", string(content))
+	_, err = os.Stat(filepath.Join(dir, "img_2.jpg"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestApplyOverlappingNamesRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-reseq")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"img_1.jpg", "img_2.jpg", "img_3.jpg"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	// the last rename fails in the second phase because its folder does not exist
+	rlog := RenameLog{
+		{OriginalFileName: "img_1.jpg", NewFileName: "img_2.jpg"},
+		{OriginalFileName: "img_2.jpg", NewFileName: "img_3.jpg"},
+		{OriginalFileName: "img_3.jpg", NewFileName: filepath.Join("missing", "img_4.jpg")},
+	}
+	assert.True(t, renamesOverlap(rlog))
+	assert.NotNil(t, Apply(rlog, dir, Opts{}))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	for _, name := range []string{"img_1.jpg", "img_2.jpg", "img_3.jpg"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, name, string(content))
+	}
+}
+
+func TestRenameIfAbsent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-reseq")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	from := filepath.Join(dir, "a.jpg")
+	to := filepath.Join(dir, "b.jpg")
+	assert.Nil(t, ioutil.WriteFile(from, []byte("a"), 0644))
+	assert.Nil(t, ioutil.WriteFile(to, []byte("b"), 0644))
+
+	assert.NotNil(t, renameIfAbsent(from, to))
+	content, err := ioutil.ReadFile(to)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(content))
+
+	assert.Nil(t, os.Remove(to))
+	assert.Nil(t, renameIfAbsent(from, to))
+}
+
+func TestResequenceMatchAndGaps(t *testing.T) {
+	p, err := NewReseqProp("num{match=last}=(\\d+)")
+	assert.Nil(t, err)
+	rlog, missing, err := Resequence(p, []string{"2020 trip 5.jpg", "2020 trip 1000000000.jpg"}, ReseqOpts{Start: 1, Width: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "2020 trip 1.jpg", rlog[0].NewFileName)
+	assert.Equal(t, "2020 trip 2.jpg", rlog[1].NewFileName)
+	assert.Equal(t, []numberRange{{start: 6, length: 999999994}}, missing)
+	assert.Equal(t, "6-999999999", formatRanges(missing))
+	assert.Equal(t, "4, 8-11", formatRanges([]numberRange{{start: 4, length: 1}, {start: 8, length: 4}}))
+
+	_, err = NewReseqProp("num{match=all}=(\\d+)")
+	assert.NotNil(t, err)
+}
+
+func TestResequenceExistingTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-reseq")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"img_2.jpg", "img_3.jpg"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	p, err := NewReseqProp("")
+	assert.Nil(t, err)
+
+	// img_2.jpg is part of the sequence and can be replaced
+	_, _, err = Resequence(p, []string{filepath.Join(dir, "img_3.jpg")}, ReseqOpts{Start: 2})
+	assert.NotNil(t, err)
+	rlog, _, err := Resequence(p, []string{filepath.Join(dir, "img_2.jpg"), filepath.Join(dir, "img_3.jpg")}, ReseqOpts{Start: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, "img_4.jpg", rlog[1].NewFileName)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SanitizeNone leaves the generated names as they are, invalid names are only reported
+	SanitizeNone = "none"
+	// SanitizePosix removes the characters Linux and other POSIX systems do not allow: / and NUL
+	SanitizePosix = "posix"
+	// SanitizeWindows removes the characters Windows does not allow, the trailing dots and spaces, and
+	// renames the reserved device names such as CON and LPT1
+	SanitizeWindows = "windows"
+	// SanitizeMacOS removes the characters macOS does not allow: /, :, and NUL
+	SanitizeMacOS = "macos"
+	// SanitizePortable produces names that are valid on all of the platforms above
+	SanitizePortable = "portable"
+)
+
+// MaxNameBytes is the maximum length of a file name on most file systems
+const MaxNameBytes = 255
+
+// sanitizeReplacement replaces the characters that are not allowed in file names
+const sanitizeReplacement = '_'
+
+// windowsReservedChars lists the printable characters Windows does not allow in file names
+const windowsReservedChars = "<>:\"/\\|?*"
+
+// windowsReservedNames lists the device names Windows does not allow as the name of a file, with or
+// without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ValidateSanitize checks the value of the --sanitize flag and returns the target platform
+func ValidateSanitize(v string) (string, error) {
+	switch v {
+	case "":
+		return SanitizeNone, nil
+	case SanitizeNone, SanitizePosix, SanitizeWindows, SanitizeMacOS, SanitizePortable:
+		return v, nil
+	}
+	err := newParseError(v, 0, "Unknown sanitize target %s, supported targets are posix, windows, macos, portable, and none", v)
+	err.Suggestion = suggest(v, []string{SanitizePosix, SanitizeWindows, SanitizeMacOS, SanitizePortable, SanitizeNone})
+	return "", err
+}
+
+// hostPlatform returns the sanitize target of the system raf is running on
+func hostPlatform() string {
+	switch runtime.GOOS {
+	case "windows":
+		return SanitizeWindows
+	case "darwin", "ios":
+		return SanitizeMacOS
+	}
+	return SanitizePosix
+}
+
+// invalidChar tells whether the character is not allowed in file names on the given platform
+func invalidChar(chr rune, platform string) bool {
+	if chr == '/' || chr == 0 {
+		return true
+	}
+	switch platform {
+	case SanitizeMacOS:
+		return chr == ':'
+	case SanitizeWindows, SanitizePortable:
+		return chr < ' ' || strings.ContainsRune(windowsReservedChars, chr)
+	}
+	return false
+}
+
+// reservedName tells whether the name is a Windows device name. Device names are reserved regardless
+// of their case and of the extension: con.txt is not a valid file name.
+func reservedName(name string) bool {
+	base := strings.SplitN(name, ".", 2)[0]
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+// trimsTrailing tells whether the platform silently drops trailing dots and spaces from file names
+func trimsTrailing(platform string) bool {
+	return platform == SanitizeWindows || platform == SanitizePortable
+}
+
+// ValidateName checks the file name against the rules of the given platform and returns a description
+// of each problem it finds. An empty result means the name is valid.
+func ValidateName(name, platform string) []string {
+	problems := make([]string, 0)
+	if name == "" || name == "." || name == ".." {
+		return append(problems, "is not a valid file name")
+	}
+
+	invalid := make([]string, 0)
+	control := false
+	for _, chr := range name {
+		switch {
+		case invalidChar(chr, platform) && chr >= ' ':
+			if !strings.Contains(strings.Join(invalid, ""), string(chr)) {
+				invalid = append(invalid, string(chr))
+			}
+		case chr < ' ' || chr == unicode.MaxASCII:
+			control = true
+		}
+	}
+	if len(invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("contains characters that are not allowed: %s", strings.Join(invalid, " ")))
+	}
+	if control {
+		problems = append(problems, "contains control characters")
+	}
+	if trimsTrailing(platform) {
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			problems = append(problems, "ends with a dot or a space")
+		}
+		if reservedName(name) {
+			problems = append(problems, "is a reserved device name on Windows")
+		}
+	}
+	if len(name) > MaxNameBytes {
+		problems = append(problems, fmt.Sprintf("is %d bytes long, the limit is %d", len(name), MaxNameBytes))
+	}
+	return problems
+}
+
+// SanitizeName makes the file name valid on the given platform: characters that are not allowed are
+// replaced with _, control characters are removed, Windows device names get a _ suffix, trailing dots
+// and spaces are dropped, and names longer than MaxNameBytes are truncated keeping their extension.
+func SanitizeName(name, platform string, compound []string) string {
+	if platform == "" || platform == SanitizeNone {
+		return name
+	}
+
+	out := strings.Builder{}
+	for _, chr := range name {
+		switch {
+		case chr < ' ' || chr == unicode.MaxASCII:
+			continue
+		case invalidChar(chr, platform):
+			out.WriteRune(sanitizeReplacement)
+		default:
+			out.WriteRune(chr)
+		}
+	}
+	sanitized := out.String()
+
+	if trimsTrailing(platform) {
+		sanitized = strings.TrimRight(sanitized, ". ")
+		if reservedName(sanitized) {
+			base := strings.SplitN(sanitized, ".", 2)
+			base[0] += string(sanitizeReplacement)
+			sanitized = strings.Join(base, ".")
+		}
+	}
+	if platform == SanitizePortable {
+		sanitized = strings.TrimLeft(sanitized, " ")
+	}
+	sanitized = shortenName(sanitized, MaxNameBytes, compound)
+	if trimsTrailing(platform) {
+		sanitized = strings.TrimRight(sanitized, ". ")
+	}
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return string(sanitizeReplacement)
+	}
+	return sanitized
+}
+
+// shortenName shortens the stem of the name so that the name fits in max bytes. The full extension
+// is kept unless it is too long on its own. Characters are never cut in half.
+func shortenName(name string, max int, compound []string) string {
+	if len(name) <= max {
+		return name
+	}
+	stem, _, ext := splitFileName(name, compound)
+	if len(ext) >= max {
+		stem, ext = name, ""
+	}
+	out := ""
+	for _, g := range graphemes(stem) {
+		if len(out)+len(g)+len(ext) > max {
+			break
+		}
+		out += g
+	}
+	return out + ext
+}
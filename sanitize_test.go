@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateName(t *testing.T) {
+	assert.Empty(t, ValidateName("Show - 01.mkv", SanitizePosix))
+	assert.Empty(t, ValidateName("Show: Pilot.mkv", SanitizePosix))
+	assert.Equal(t, []string{"contains characters that are not allowed: :"}, ValidateName("Show: Pilot.mkv", SanitizeMacOS))
+	assert.Equal(t, []string{"contains characters that are not allowed: / :"}, ValidateName("AC/DC: Live.mkv", SanitizeWindows))
+	assert.Equal(t, []string{"contains control characters"}, ValidateName("Show\t01.mkv", SanitizePosix))
+	assert.Equal(t, []string{"ends with a dot or a space"}, ValidateName("Show.", SanitizeWindows))
+	assert.Empty(t, ValidateName("Show.", SanitizePosix))
+	assert.Equal(t, []string{"is a reserved device name on Windows"}, ValidateName("con.txt", SanitizePortable))
+	assert.Empty(t, ValidateName("console.txt", SanitizeWindows))
+	assert.Equal(t, []string{"is not a valid file name"}, ValidateName("..", SanitizePosix))
+	assert.Equal(t, []string{"is 260 bytes long, the limit is 255"}, ValidateName(strings.Repeat("a", 256)+".mkv", SanitizePosix))
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "AC_DC: Live.mkv", SanitizeName("AC/DC: Live.mkv", SanitizePosix, nil))
+	assert.Equal(t, "AC_DC_ Live.mkv", SanitizeName("AC/DC: Live.mkv", SanitizeMacOS, nil))
+	assert.Equal(t, "What_ _Really_.mkv", SanitizeName("What? \"Really\".mkv", SanitizeWindows, nil))
+	assert.Equal(t, "Show01.mkv", SanitizeName("Show\x0001\n.mkv", SanitizePosix, nil))
+	assert.Equal(t, "Show", SanitizeName("Show. . ", SanitizeWindows, nil))
+	assert.Equal(t, "CON_.txt", SanitizeName("CON.txt", SanitizeWindows, nil))
+	assert.Equal(t, "lpt1_", SanitizeName("lpt1", SanitizePortable, nil))
+	assert.Equal(t, "Show.mkv", SanitizeName("  Show.mkv", SanitizePortable, nil))
+	assert.Equal(t, "_", SanitizeName("...", SanitizeWindows, nil))
+	assert.Equal(t, "a/b", SanitizeName("a/b", SanitizeNone, nil))
+}
+
+func TestSanitizeTruncate(t *testing.T) {
+	name := SanitizeName(strings.Repeat("a", 300)+".tar.gz", SanitizePosix, DefaultCompoundExtensions)
+	assert.Equal(t, MaxNameBytes, len(name))
+	assert.True(t, strings.HasSuffix(name, "a.tar.gz"))
+
+	// multi-byte characters are never cut in half
+	name = SanitizeName(strings.Repeat("é", 200)+".mkv", SanitizePosix, nil)
+	assert.Equal(t, 254, len(name))
+	assert.True(t, strings.HasSuffix(name, "é.mkv"))
+}
+
+func TestRenameInvalidNameWarning(t *testing.T) {
+	tokens, err := ParseOutput("$title.mkv")
+	assert.Nil(t, err)
+	prop, err := ParseProp("title=^(.*)\\.avi")
+	assert.Nil(t, err)
+
+	rlog, err := RenameAllFiles([]Prop{prop}, nil, tokens, []string{"AC:DC.avi"}, Opts{Sanitize: SanitizeNone})
+	assert.Nil(t, err)
+	assert.Equal(t, "AC:DC.mkv", rlog[0].NewFileName)
+
+	rlog, err = RenameAllFiles([]Prop{prop}, nil, tokens, []string{"AC:DC.avi"}, Opts{Sanitize: SanitizeWindows})
+	assert.Nil(t, err)
+	assert.Equal(t, "AC_DC.mkv", rlog[0].NewFileName)
+	assert.Empty(t, rlog[0].Warnings)
+
+	tokens, err = ParseOutput("$title/.mkv")
+	assert.Nil(t, err)
+	rlog, err = RenameAllFiles([]Prop{prop}, nil, tokens, []string{"Live.avi"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rlog[0].Warnings))
+	assert.Equal(t, RenameWarningTypeInvalidName, rlog[0].Warnings[0].Type)
+	assert.Equal(t, "WARNING: New file name Live/.mkv contains characters that are not allowed: /", rlog[0].Warnings[0].String(rlog[0]))
+}
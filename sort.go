@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SortNone keeps the order in which the files are passed to raf
+	SortNone = "none"
+	// SortName sorts the files by name
+	SortName = "name"
+	// SortNatural sorts the files by name, comparing the numbers in the names by their value
+	SortNatural = "natural"
+	// SortMtime sorts the files by modification time
+	SortMtime = "mtime"
+	// SortCtime sorts the files by status change time, or creation time on Windows
+	SortCtime = "ctime"
+	// SortSize sorts the files by size
+	SortSize = "size"
+	// SortPropPrefix sorts the files by the value of a property, compared with the natural order:
+	// prop:season
+	SortPropPrefix = "prop:"
+)
+
+// ValidateSort checks the value of the --sort flag and returns the sort key. Properties are returned
+// with the prop: prefix and the $ prefix of the variable name: prop:$season.
+func ValidateSort(v string) (string, error) {
+	switch v {
+	case "", SortNone:
+		return SortNone, nil
+	case SortName, SortNatural, SortMtime, SortCtime, SortSize:
+		return v, nil
+	}
+	if strings.HasPrefix(v, SortPropPrefix) {
+		name := strings.TrimPrefix(strings.TrimPrefix(v, SortPropPrefix), "$")
+		if name == "" {
+			return "", newParseError(v, len(SortPropPrefix), "Missing property name in sort order, the format is prop:<name>")
+		}
+		return SortPropPrefix + "$" + name, nil
+	}
+	err := newParseError(v, 0, "Unknown sort order %s, supported orders are name, natural, mtime, ctime, size, prop:<name>, and none", v)
+	err.Suggestion = suggest(v, []string{SortName, SortNatural, SortMtime, SortCtime, SortSize, SortNone})
+	return "", err
+}
+
+// sortJobs sorts the jobs with the given sort key and assigns their idx in the new order. Jobs that
+// compare equal keep the order in which the files were passed to raf.
+func sortJobs(jobs []renameJob, key string, reverse bool) error {
+	if key == "" || key == SortNone {
+		if reverse {
+			for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+				jobs[i], jobs[j] = jobs[j], jobs[i]
+			}
+		}
+		assignIdx(jobs)
+		return nil
+	}
+
+	var less func(a, b renameJob) bool
+	switch key {
+	case SortName:
+		less = func(a, b renameJob) bool {
+			return a.state.fileName < b.state.fileName
+		}
+	case SortNatural:
+		less = func(a, b renameJob) bool {
+			return naturalLess(a.state.fileName, b.state.fileName)
+		}
+	case SortMtime, SortCtime, SortSize:
+		for _, job := range jobs {
+			if job.state.meta.stat() == nil {
+				return fmt.Errorf("Could not sort by %s, the metadata of %s could not be read: %v", key, job.state.path, job.state.meta.err)
+			}
+		}
+		less = statLess(key)
+	default:
+		prop := strings.TrimPrefix(key, SortPropPrefix)
+		for _, job := range jobs {
+			if _, ok := job.varValues[prop]; !ok {
+				return fmt.Errorf("Could not sort by %s, the property is not declared", prop)
+			}
+		}
+		less = func(a, b renameJob) bool {
+			return naturalLess(a.varValues[prop], b.varValues[prop])
+		}
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if reverse {
+			return less(jobs[j], jobs[i])
+		}
+		return less(jobs[i], jobs[j])
+	})
+	assignIdx(jobs)
+	return nil
+}
+
+func statLess(key string) func(a, b renameJob) bool {
+	return func(a, b renameJob) bool {
+		ia := a.state.meta.stat()
+		ib := b.state.meta.stat()
+		switch key {
+		case SortSize:
+			return ia.Size() < ib.Size()
+		case SortCtime:
+			_, ca := fileTimes(ia)
+			_, cb := fileTimes(ib)
+			return ca.Before(cb)
+		}
+		return ia.ModTime().Before(ib.ModTime())
+	}
+}
+
+func assignIdx(jobs []renameJob) {
+	for idx := range jobs {
+		jobs[idx].state.idx = idx
+	}
+}
+
+// naturalLess compares two strings splitting them in chunks of digits and chunks of other characters.
+// Chunks of digits are compared by their numeric value, so that ep2 comes before ep10, other chunks
+// are compared case-insensitively. Strings that compare equal are ordered with a plain comparison.
+func naturalLess(a, b string) bool {
+	ra := []rune(a)
+	rb := []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		ca, da := nextChunk(ra, i)
+		cb, db := nextChunk(rb, j)
+		i += len(ca)
+		j += len(cb)
+		if da && db {
+			na := strings.TrimLeft(string(ca), "0")
+			nb := strings.TrimLeft(string(cb), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		la := strings.ToLower(string(ca))
+		lb := strings.ToLower(string(cb))
+		if la != lb {
+			return la < lb
+		}
+	}
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+	return a < b
+}
+
+// nextChunk returns the chunk of digits or of other characters starting at the given position and
+// whether it contains digits
+func nextChunk(runes []rune, pos int) ([]rune, bool) {
+	digits := unicode.IsDigit(runes[pos])
+	end := pos
+	for end < len(runes) && unicode.IsDigit(runes[end]) == digits {
+		end++
+	}
+	return runes[pos:end], digits
+}
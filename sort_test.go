@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNaturalLess(t *testing.T) {
+	assert.True(t, naturalLess("ep2.mkv", "ep10.mkv"))
+	assert.False(t, naturalLess("ep10.mkv", "ep2.mkv"))
+	assert.True(t, naturalLess("Show S1 E9", "show s1 e10"))
+	assert.True(t, naturalLess("v1.2.9", "v1.10.0"))
+	assert.True(t, naturalLess("ep", "ep1"))
+	assert.True(t, naturalLess("ep01", "ep1"))
+	assert.False(t, naturalLess("ep1", "ep1"))
+}
+
+func sortedNames(t *testing.T, jobs []renameJob) []string {
+	names := make([]string, len(jobs))
+	for idx, job := range jobs {
+		assert.Equal(t, idx, job.state.idx)
+		names[idx] = job.state.fileName
+	}
+	return names
+}
+
+func TestSortJobs(t *testing.T) {
+	newJobs := func() []renameJob {
+		jobs := make([]renameJob, 0)
+		for idx, name := range []string{"ep10.mkv", "ep2.mkv", "Ep1.mkv", "ep2.mkv"} {
+			jobs = append(jobs, renameJob{
+				state:     renamerState{idx: idx, fileName: name},
+				varValues: VarValues{"$ep": name[2 : len(name)-4]},
+			})
+		}
+		return jobs
+	}
+
+	jobs := newJobs()
+	assert.Nil(t, sortJobs(jobs, SortName, false))
+	assert.Equal(t, []string{"Ep1.mkv", "ep10.mkv", "ep2.mkv", "ep2.mkv"}, sortedNames(t, jobs))
+
+	jobs = newJobs()
+	assert.Nil(t, sortJobs(jobs, SortNatural, false))
+	assert.Equal(t, []string{"Ep1.mkv", "ep2.mkv", "ep2.mkv", "ep10.mkv"}, sortedNames(t, jobs))
+
+	jobs = newJobs()
+	assert.Nil(t, sortJobs(jobs, "prop:$ep", true))
+	assert.Equal(t, []string{"ep10.mkv", "ep2.mkv", "ep2.mkv", "Ep1.mkv"}, sortedNames(t, jobs))
+
+	jobs = newJobs()
+	assert.Nil(t, sortJobs(jobs, SortNone, true))
+	assert.Equal(t, []string{"ep2.mkv", "Ep1.mkv", "ep2.mkv", "ep10.mkv"}, sortedNames(t, jobs))
+
+	assert.NotNil(t, sortJobs(newJobs(), "prop:$title", false))
+}
+
+func TestSortJobsByStat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-sort")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := []string{}
+	for idx, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, make([]byte, 3-idx), 0644))
+		mtime := time.Date(2020, 11, 20-idx, 0, 0, 0, 0, time.Local)
+		assert.Nil(t, os.Chtimes(path, mtime, mtime))
+		files = append(files, path)
+	}
+
+	tokens, err := ParseOutput("$cnt")
+	assert.Nil(t, err)
+	jobs, err := prepareRename(nil, nil, tokens, files, Opts{Sort: SortMtime})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c.mkv", "b.mkv", "a.mkv"}, sortedNames(t, jobs))
+	assert.Equal(t, "1", jobs[0].varValues["$cnt"])
+
+	jobs, err = prepareRename(nil, nil, tokens, files, Opts{Sort: SortSize, Reverse: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.mkv", "b.mkv", "c.mkv"}, sortedNames(t, jobs))
+}
+
+func TestValidateSort(t *testing.T) {
+	key, err := ValidateSort("prop:season")
+	assert.Nil(t, err)
+	assert.Equal(t, "prop:$season", key)
+
+	key, err = ValidateSort("")
+	assert.Nil(t, err)
+	assert.Equal(t, SortNone, key)
+
+	_, err = ValidateSort("natrual")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, SortNatural, err.(*ParseError).Suggestion)
+
+	_, err = ValidateSort("prop:")
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// fileMeta loads the metadata of a file the first time an intrinsic asks for it. Intrinsics such as
+// $size and $mtime share the same fileMeta so that each file is only read from disk once, and files
+// are not read at all when the output does not reference these intrinsics.
+type fileMeta struct {
+	path   string
+	loaded bool
+	info   os.FileInfo
+	err    error
+}
+
+func newFileMeta(path string) *fileMeta {
+	return &fileMeta{path: path}
+}
+
+// stat returns the FileInfo of the file, or nil if the file could not be read. The error is stored
+// in the err field.
+func (m *fileMeta) stat() os.FileInfo {
+	if m == nil {
+		return nil
+	}
+	if !m.loaded {
+		m.loaded = true
+		m.info, m.err = os.Stat(m.path)
+	}
+	return m.info
+}
+
+// statValue calls the given function with the FileInfo of the file and returns an empty string when
+// the file could not be read
+func (m *fileMeta) statValue(f func(os.FileInfo) string) string {
+	info := m.stat()
+	if info == nil {
+		return ""
+	}
+	return f(info)
+}
+
+// formatTime formats the timestamps of a file as RFC3339 strings in the local time zone
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// humanSize formats a size in bytes the same way as ls -h: 512B, 1.5K, 23M
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + "B"
+	}
+	value := float64(size)
+	suffixes := "KMGTPE"
+	idx := -1
+	for value >= unit && idx < len(suffixes)-1 {
+		value /= unit
+		idx++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%c", value, suffixes[idx])
+	}
+	return fmt.Sprintf("%.0f%c", value, suffixes[idx])
+}
+
+// userName looks up the name of the user with the given id. If the user does not exist, the function
+// returns the id.
+func userName(uid string) string {
+	if uid == "" {
+		return ""
+	}
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+	return u.Username
+}
+
+// groupName looks up the name of the group with the given id. If the group does not exist, the
+// function returns the id.
+func groupName(gid string) string {
+	if gid == "" {
+		return ""
+	}
+	g, err := user.LookupGroupId(gid)
+	if err != nil {
+		return gid
+	}
+	return g.Name
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// fileOwner returns empty values on systems that do not expose the owner and inode of a file
+func fileOwner(info os.FileInfo) (string, string, string) {
+	return "", "", ""
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "512B", humanSize(512))
+	assert.Equal(t, "1.5K", humanSize(1536))
+	assert.Equal(t, "23M", humanSize(23*1024*1024))
+	assert.Equal(t, "1.0G", humanSize(1024*1024*1024))
+}
+
+func TestStatIntrinsics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raf-stat")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "video.mkv")
+	assert.Nil(t, ioutil.WriteFile(path, make([]byte, 2048), 0644))
+	mtime := time.Date(2020, 11, 20, 10, 30, 0, 0, time.Local)
+	assert.Nil(t, os.Chtimes(path, mtime, mtime))
+
+	tokens, err := ParseOutput("$size $hsize $mtime")
+	assert.Nil(t, err)
+	jobs, err := prepareRename(nil, nil, tokens, []string{path}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "2048", jobs[0].varValues["$size"])
+	assert.Equal(t, "2.0K", jobs[0].varValues["$hsize"])
+	assert.Equal(t, mtime.Format(time.RFC3339), jobs[0].varValues["$mtime"])
+	_, ok := jobs[0].varValues["$inode"]
+	assert.False(t, ok)
+}
+
+func TestStatIsLazy(t *testing.T) {
+	tokens, err := ParseOutput("$fname")
+	assert.Nil(t, err)
+	// the file does not exist, reading its metadata would fail
+	jobs, err := prepareRename(nil, nil, tokens, []string{"does-not-exist.mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.False(t, jobs[0].state.meta.loaded)
+
+	tokens, err = ParseOutput("$size")
+	assert.Nil(t, err)
+	_, err = prepareRename(nil, nil, tokens, []string{"does-not-exist.mkv"}, Opts{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,19 @@
+//go:build linux || openbsd || dragonfly || solaris
+// +build linux openbsd dragonfly solaris
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns the last access time and the status change time of the file
+func fileTimes(info os.FileInfo) (time.Time, time.Time) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)), time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd && !windows
+// +build !linux,!openbsd,!dragonfly,!solaris,!darwin,!freebsd,!netbsd,!windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// fileTimes returns the modification time of the file on systems that do not expose its access and
+// status change times
+func fileTimes(info os.FileInfo) (time.Time, time.Time) {
+	return info.ModTime(), info.ModTime()
+}
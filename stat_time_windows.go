@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns the last access time and the creation time of the file
+func fileTimes(info os.FileInfo) (time.Time, time.Time) {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(0, attrs.LastAccessTime.Nanoseconds()), time.Unix(0, attrs.CreationTime.Nanoseconds())
+}
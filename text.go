@@ -0,0 +1,60 @@
+package main
+
+import (
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// zeroWidthJoiner joins emoji into a single grapheme cluster
+const zeroWidthJoiner = '\u200d'
+
+// graphemes splits a value in user-perceived characters: a base rune followed by its combining marks,
+// variation selectors, and the runes joined with a zero width joiner. Formatters that count characters
+// use graphemes so that accented letters written with combining marks are never split.
+func graphemes(value string) []string {
+	out := make([]string, 0, len(value))
+	runes := []rune(value)
+	start := 0
+	for idx := 1; idx <= len(runes); idx++ {
+		if idx < len(runes) && extendsGrapheme(runes[idx-1], runes[idx]) {
+			continue
+		}
+		out = append(out, string(runes[start:idx]))
+		start = idx
+	}
+	return out
+}
+
+// extendsGrapheme tells whether the rune belongs to the same grapheme as the previous rune
+func extendsGrapheme(prev, chr rune) bool {
+	return unicode.In(chr, unicode.Mn, unicode.Me, unicode.Mc) ||
+		unicode.Is(unicode.Variation_Selector, chr) ||
+		chr == zeroWidthJoiner || prev == zeroWidthJoiner
+}
+
+// displayWidth returns the number of terminal columns a grapheme occupies: 2 for East Asian wide and
+// fullwidth characters, 1 for everything else
+func displayWidth(grapheme string) int {
+	for _, chr := range grapheme {
+		switch width.LookupRune(chr).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// textLength returns the length of a value in graphemes or, if columns is true, in terminal columns
+func textLength(value string, columns bool) int {
+	length := 0
+	for _, g := range graphemes(value) {
+		if columns {
+			length += displayWidth(g)
+		} else {
+			length++
+		}
+	}
+	return length
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultTransliterationReplacement replaces the characters the transliteration cannot map to ASCII
+const DefaultTransliterationReplacement = '_'
+
+// TransliterateFormatter converts a value to ASCII. Accents and other combining marks are removed,
+// letters such as ß and æ are spelled out, Greek, Cyrillic, Japanese kana, and Korean hangul are
+// romanized. Runs of characters that cannot be mapped, such as Chinese ideographs or emoji, are replaced
+// with a single Replacement character. The transliteration formatter is called with the ~ character,
+// optionally followed by the replacement character: $title[~], $title[~-].
+type TransliterateFormatter struct {
+	Replacement rune
+}
+
+// NewTransliterateFormatter creates a new transliteration formatter with the given replacement character
+func NewTransliterateFormatter(replacement rune) TransliterateFormatter {
+	return TransliterateFormatter{
+		Replacement: replacement,
+	}
+}
+
+// Format transliterates the given value to ASCII
+func (f *TransliterateFormatter) Format(value string, rstate renamerState) (string, error) {
+	return Transliterate(value, f.Replacement), nil
+}
+
+// String returns the transliteration formatter declaration as it appears in the output definition
+func (f *TransliterateFormatter) String() string {
+	return "~" + string(f.Replacement)
+}
+
+// latinTransliterations spells out the Latin letters and the punctuation that do not decompose to ASCII
+var latinTransliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th", 'ł': "l", 'ı': "i",
+	'ħ': "h", 'ŋ': "ng", 'ĸ': "k", 'ſ': "s", 'ŧ': "t", 'ƒ': "f",
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"",
+	'‹': "'", '›': "'", '‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-", '−': "-",
+	'·': ".", '•': "-", '×': "x", '÷': "-", '€': "EUR", '£': "GBP", '¥': "JPY", '©': "(c)", '®': "(r)",
+	'¿': "?", '¡': "!", '°': "deg",
+}
+
+// greekTransliterations romanizes the lower case Greek letters
+var greekTransliterations = map[rune]string{
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i",
+	'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s",
+	'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// cyrillicTransliterations romanizes the lower case Cyrillic letters of the Russian, Ukrainian,
+// Belarusian, and Serbian alphabets
+var cyrillicTransliterations = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye",
+	'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+}
+
+// kanaTransliterations romanizes hiragana with the Hepburn system. Katakana are mapped to the
+// corresponding hiragana before the lookup.
+var kanaTransliterations = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゎ': "wa",
+}
+
+// kanaSmallY are the small kana that combine with the previous syllable: き+ゃ is kya
+var kanaSmallY = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+const (
+	kanaSmallTsu   = 'っ'
+	kanaLongVowel  = 'ー'
+	hangulFirst    = 0xAC00
+	hangulLast     = 0xD7A3
+	hangulVowels   = 21
+	hangulFinals   = 28
+	katakanaOffset = 'ア' - 'あ'
+)
+
+// hangulInitials, hangulMedials, and hangulFinalConsonants romanize the parts of a hangul syllable
+// with the Revised Romanization of Korean
+var (
+	hangulInitials        = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulMedials         = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinalConsonants = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "l", "l", "l", "l", "l", "l", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+)
+
+// Transliterate converts the value to ASCII. Runs of characters that cannot be transliterated are
+// replaced with a single replacement character.
+func Transliterate(value string, replacement rune) string {
+	runes := []rune(norm.NFC.String(value))
+	out := strings.Builder{}
+	replaced := false
+	doubleNext := false
+	for idx := 0; idx < len(runes); idx++ {
+		chr := runes[idx]
+		if chr <= unicode.MaxASCII {
+			out.WriteRune(chr)
+			replaced = false
+			continue
+		}
+
+		ascii, ok := transliterateRune(chr)
+		if ok && isKana(chr) {
+			ascii, idx, doubleNext = romanizeKana(runes, idx, ascii, doubleNext)
+		} else if ok && unicode.IsUpper(chr) && ascii != "" {
+			ascii = strings.ToUpper(ascii[:1]) + ascii[1:]
+			if idx+1 < len(runes) && unicode.IsUpper(runes[idx+1]) || idx > 0 && unicode.IsUpper(runes[idx-1]) && (idx+1 == len(runes) || !unicode.IsLower(runes[idx+1])) {
+				ascii = strings.ToUpper(ascii)
+			}
+		}
+		if !ok {
+			if !replaced {
+				out.WriteRune(replacement)
+			}
+			replaced = true
+			continue
+		}
+		out.WriteString(ascii)
+		replaced = false
+	}
+	return out.String()
+}
+
+// transliterateRune returns the ASCII spelling of a single character in lower case, unless the
+// character decomposes to upper case ASCII letters. The second return value is false if the character
+// cannot be transliterated.
+func transliterateRune(chr rune) (string, bool) {
+	if isKana(chr) {
+		if chr >= 'ァ' && chr <= 'ヶ' {
+			chr -= katakanaOffset
+		}
+		if chr == kanaSmallTsu || chr == kanaLongVowel {
+			return "", true
+		}
+		if _, ok := kanaSmallY[chr]; ok {
+			return "", true
+		}
+		ascii, ok := kanaTransliterations[chr]
+		return ascii, ok
+	}
+	if chr >= hangulFirst && chr <= hangulLast {
+		syllable := int(chr - hangulFirst)
+		initial := syllable / (hangulVowels * hangulFinals)
+		medial := syllable % (hangulVowels * hangulFinals) / hangulFinals
+		final := syllable % hangulFinals
+		return hangulInitials[initial] + hangulMedials[medial] + hangulFinalConsonants[final], true
+	}
+
+	lower := unicode.ToLower(chr)
+	if ascii, ok := cyrillicTransliterations[lower]; ok {
+		return ascii, true
+	}
+
+	// decompose to look up the base letter and to drop accents and other marks
+	decomposed := norm.NFKD.String(string(chr))
+	base := []rune(decomposed)[0]
+	for _, table := range []map[rune]string{latinTransliterations, greekTransliterations, cyrillicTransliterations} {
+		if ascii, ok := table[unicode.ToLower(base)]; ok {
+			return ascii, true
+		}
+		if ascii, ok := table[base]; ok {
+			return ascii, true
+		}
+	}
+	ascii := ""
+	for _, c := range decomposed {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		if c > unicode.MaxASCII {
+			return "", false
+		}
+		ascii += string(c)
+	}
+	// a lone combining mark transliterates to nothing
+	return ascii, ascii != "" || unicode.Is(unicode.Mn, chr)
+}
+
+// isKana tells whether the character is a hiragana or a katakana
+func isKana(chr rune) bool {
+	return chr >= 'ぁ' && chr <= 'ゔ' || chr >= 'ァ' && chr <= 'ヶ' || chr == kanaLongVowel
+}
+
+// romanizeKana completes the romanization of the kana at idx: it combines the syllable with a following
+// small ya, yu, or yo, doubles the consonant after a small tsu, and extends the previous vowel for the
+// long vowel mark. It returns the romanization, the index of the last rune consumed, and whether the
+// consonant of the next syllable should be doubled.
+func romanizeKana(runes []rune, idx int, ascii string, doubleNext bool) (string, int, bool) {
+	chr := runes[idx]
+	if chr >= 'ァ' && chr <= 'ヶ' {
+		chr -= katakanaOffset
+	}
+	switch {
+	case chr == kanaSmallTsu:
+		return "", idx, true
+	case chr == kanaLongVowel:
+		if idx > 0 {
+			prev, _ := transliterateRune(runes[idx-1])
+			if prev != "" {
+				return prev[len(prev)-1:], idx, false
+			}
+		}
+		return "", idx, false
+	}
+	if idx+1 < len(runes) && strings.HasSuffix(ascii, "i") && len(ascii) > 1 {
+		next := runes[idx+1]
+		if next >= 'ァ' && next <= 'ヶ' {
+			next -= katakanaOffset
+		}
+		if vowel, ok := kanaSmallY[next]; ok {
+			stem := ascii[:len(ascii)-1]
+			if stem != "sh" && stem != "ch" && stem != "j" {
+				stem += "y"
+			}
+			ascii = stem + vowel
+			idx++
+		}
+	}
+	if doubleNext && ascii != "" && !strings.ContainsAny(ascii[:1], "aeiou") {
+		if strings.HasPrefix(ascii, "ch") {
+			ascii = "t" + ascii
+		} else {
+			ascii = ascii[:1] + ascii
+		}
+	}
+	return ascii, idx, false
+}
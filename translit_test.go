@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransliterate(t *testing.T) {
+	tests := map[string]string{
+		"Crème Brûlée":      "Creme Brulee",
+		"Cre\u0300me":       "Creme",
+		"Straße":            "Strasse",
+		"Ærø":               "Aero",
+		"ŁÓDŹ":              "LODZ",
+		"Москва":            "Moskva",
+		"ЖУК и Жук":         "ZHUK i Zhuk",
+		"Αθήνα":             "Athina",
+		"きょうと":              "kyouto",
+		"がっこう":              "gakkou",
+		"ラーメン":              "raamen",
+		"서울":                "seoul",
+		"naïve ﬁle":         "naive file",
+		"“quoted” — dashes": "\"quoted\" - dashes",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, Transliterate(in, '_'), in)
+	}
+}
+
+func TestTransliterateReplacement(t *testing.T) {
+	assert.Equal(t, "_ 2020.mkv", Transliterate("東京 2020.mkv", '_'))
+	assert.Equal(t, "Tokyo-.mkv", Transliterate("Tokyo東京.mkv", '-'))
+	assert.Equal(t, "x_x", Transliterate("x😀x", '_'))
+}
+
+func TestTransliterateFormatterParser(t *testing.T) {
+	tokens, err := ParseOutput("$title[~]")
+	assert.Nil(t, err)
+	formatter, ok := tokens[0].Formatter[0].(*TransliterateFormatter)
+	assert.True(t, ok)
+	assert.Equal(t, DefaultTransliterationReplacement, formatter.Replacement)
+
+	tokens, err = ParseOutput("$title[~-,>:5]")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens[0].Formatter))
+	assert.Equal(t, "~-", tokens[0].Formatter[0].(*TransliterateFormatter).String())
+
+	_, err = ParseOutput("$title[~ö]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 8, err.(*ParseError).Pos)
+
+	_, err = ParseOutput("$title[~--]")
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestGenerateNameASCII(t *testing.T) {
+	tokens, err := ParseOutput("$title - Ü$ext")
+	assert.Nil(t, err)
+	name, _, err := GenerateName(VarValues{"$title": "Čajovna", "$ext": ".mkv"}, tokens, renamerState{}, Opts{ASCII: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "Cajovna - U.mkv", name)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Var is a computed variable. Its value is generated with the GenerateName function from a template
+// that follows the same syntax as the output definition, and can reference props, intrinsics, and
+// other vars. Once computed, the value is available to the output as $name.
+type Var struct {
+	Name     string
+	Template string
+	Tokens   TokenStream
+}
+
+// ParseVar populates a Var object based on the string format passed to the cli: "name=template". For
+// example: "base=$show[/\./ /] S$season[%02]".
+func ParseVar(v string) (Var, error) {
+	sep := strings.Index(v, "=")
+	if sep < 0 {
+		return Var{}, newParseError(v, len([]rune(v)), "Invalid variable definition. Variable definitions must contain a name and a template: name=template")
+	}
+	name := v[:sep]
+	if name == "" {
+		return Var{}, newParseError(v, 0, "Missing variable name")
+	}
+	for idx, chr := range []rune(name) {
+		if !unicode.IsLetter(chr) && !unicode.IsDigit(chr) {
+			return Var{}, newParseError(v, idx, "Invalid character %s in variable name, names can only contain letters and digits", string(chr))
+		}
+	}
+	if reservedVarNames["$"+name] {
+		return Var{}, newParseError(v, 0, "The variable name %s is reserved", name)
+	}
+
+	template := v[sep+1:]
+	tokens, err := ParseOutput(template)
+	if err != nil {
+		return Var{}, shiftParseError(err, v, len([]rune(name))+1)
+	}
+	return Var{
+		Name:     name,
+		Template: template,
+		Tokens:   tokens,
+	}, nil
+}
+
+// shiftParseError moves the position of a ParseError generated while parsing a portion of a larger
+// definition so that it points to the same character in the full definition. Other errors are
+// returned unchanged.
+func shiftParseError(err error, input string, offset int) error {
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		return err
+	}
+	shifted := newParseError(input, parseErr.Pos+offset, "%s", parseErr.Msg)
+	shifted.Suggestion = parseErr.Suggestion
+	return shifted
+}
+
+// ValidateVarNames checks that each var name is declared once and does not shadow a variable
+// declared by a prop, such as the prop name or the name of one of its capture groups.
+func ValidateVarNames(vars []Var, props []Prop) error {
+	declaredBy := make(map[string]string)
+	for _, p := range props {
+		for _, name := range p.VarNames() {
+			declaredBy[name] = p.Name
+		}
+	}
+	seen := make(map[string]bool)
+	for _, v := range vars {
+		definition := v.Name + "=" + v.Template
+		if prop, ok := declaredBy["$"+v.Name]; ok {
+			return newParseError(definition, 0, "The variable name %s is already declared by the property $%s", v.Name, prop)
+		}
+		if seen[v.Name] {
+			return newParseError(definition, 0, "The variable %s is declared more than once", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// declaredVarNames returns the names of all the variables defined by the props and vars, including
+// the $ prefix
+func declaredVarNames(props []Prop, vars []Var) []string {
+	declared := make([]string, 0)
+	for _, p := range props {
+		declared = append(declared, p.VarNames()...)
+	}
+	for _, v := range vars {
+		declared = append(declared, "$"+v.Name)
+	}
+	return declared
+}
+
+// SortVars orders the vars so that each var comes after the vars its template references. Vars without
+// dependencies keep their relative order. The function returns an error if the vars reference each
+// other in a cycle.
+func SortVars(vars []Var) ([]Var, error) {
+	names := make([]string, len(vars))
+	definedBy := make(map[string]int)
+	for idx, v := range vars {
+		names[idx] = "$" + v.Name
+		definedBy["$"+v.Name] = idx
+	}
+
+	order, err := sortByDependencies(names, func(idx int) ([]int, error) {
+		deps := make([]int, 0)
+		for _, t := range propertyTokens(vars[idx].Tokens) {
+			if dep, ok := definedBy[t.Value]; ok {
+				deps = append(deps, dep)
+			}
+		}
+		return deps, nil
+	}, "The variables reference each other in a cycle")
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]Var, len(order))
+	for pos, idx := range order {
+		sorted[pos] = vars[idx]
+	}
+	return sorted, nil
+}
+
+// computeVars generates the value of each var from its template and stores it in the variable values.
+// The vars must be sorted with SortVars.
+func computeVars(vars []Var, varValues VarValues, rstate renamerState, opts Opts) ([]RenameWarning, error) {
+	warnings := make([]RenameWarning, 0)
+	for _, v := range vars {
+		value, varWarnings, err := renderTokens(varValues, v.Tokens, rstate, opts, nil)
+		if err != nil {
+			return warnings, fmt.Errorf("Could not compute variable $%s: %v", v.Name, err)
+		}
+		varValues["$"+v.Name] = value
+		warnings = append(warnings, varWarnings...)
+	}
+	return warnings, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVar(t *testing.T) {
+	v, err := ParseVar("base=$show[/\\./ /] S$season[%02]")
+	assert.Nil(t, err)
+	assert.Equal(t, "base", v.Name)
+	assert.Equal(t, "$show[/\\./ /] S$season[%02]", v.Template)
+	assert.Equal(t, 3, len(v.Tokens))
+
+	_, err = ParseVar("base")
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseVar("cnt=$show")
+	assert.IsType(t, &ParseError{}, err)
+
+	// errors in the template point to the full definition
+	_, err = ParseVar("base=$show[+]")
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, 11, err.(*ParseError).Pos)
+	assert.Equal(t, "base=$show[+]", err.(*ParseError).Input)
+}
+
+func TestValidateVarNames(t *testing.T) {
+	p, err := ParseProp("re=(?P<show>.+)\\.S(?P<season>\\d+)")
+	assert.Nil(t, err)
+	base, err := ParseVar("base=$show S$season")
+	assert.Nil(t, err)
+	assert.Nil(t, ValidateVarNames([]Var{base}, []Prop{p}))
+
+	for _, def := range []string{"re=$show", "show=$re", "season=x"} {
+		v, err := ParseVar(def)
+		assert.Nil(t, err)
+		err = ValidateVarNames([]Var{base, v}, []Prop{p})
+		assert.IsType(t, &ParseError{}, err, def)
+		assert.Contains(t, err.Error(), "already declared by the property $re", def)
+	}
+
+	err = ValidateVarNames([]Var{base, base}, []Prop{p})
+	assert.IsType(t, &ParseError{}, err)
+	assert.Contains(t, err.Error(), "declared more than once")
+}
+
+func TestSortVars(t *testing.T) {
+	full, err := ParseVar("full=$base E$ep")
+	assert.Nil(t, err)
+	base, err := ParseVar("base=$show S$season")
+	assert.Nil(t, err)
+
+	sorted, err := SortVars([]Var{full, base})
+	assert.Nil(t, err)
+	assert.Equal(t, "base", sorted[0].Name)
+	assert.Equal(t, "full", sorted[1].Name)
+
+	a, err := ParseVar("a=$b")
+	assert.Nil(t, err)
+	b, err := ParseVar("b=x$a")
+	assert.Nil(t, err)
+	_, err = SortVars([]Var{a, b})
+	assert.EqualError(t, err, "The variables reference each other in a cycle: $a -> $b -> $a")
+
+	self, err := ParseVar("self=$self")
+	assert.Nil(t, err)
+	_, err = SortVars([]Var{self})
+	assert.NotNil(t, err)
+}
+
+func TestRenameWithVars(t *testing.T) {
+	p, err := ParseProp("re=(?P<show>.+)\\.S(?P<season>\\d+)E(?P<ep>\\d+)")
+	assert.Nil(t, err)
+	full, err := ParseVar("full=$base E$ep")
+	assert.Nil(t, err)
+	base, err := ParseVar("base=$show[/\\./ /] S$season[%03]")
+	assert.Nil(t, err)
+	out, err := ParseOutput("$full$ext")
+	assert.Nil(t, err)
+
+	rlog, err := RenameAllFiles([]Prop{p}, []Var{full, base}, out, []string{"The.Show.S01E05.mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "The Show S001 E05.mkv", rlog[0].NewFileName)
+}
+
+func TestVarsWithGroups(t *testing.T) {
+	p, err := ParseProp("re=(?P<show>[^.]+)\\.?(?P<title>[^.]*)\\.avi")
+	assert.Nil(t, err)
+	// trailing spaces in a var are kept, only the generated name is sanitized
+	label, err := ParseVar("label=${title:-$show} ")
+	assert.Nil(t, err)
+	out, err := ParseOutput("${label}- x.")
+	assert.Nil(t, err)
+
+	rlog, err := RenameAllFiles([]Prop{p}, []Var{label}, out, []string{"Show.avi", "Show.Pilot.avi"}, Opts{Sanitize: SanitizeWindows})
+	assert.Nil(t, err)
+	assert.Equal(t, "Show - x", rlog[0].NewFileName)
+	assert.Equal(t, "Pilot - x", rlog[1].NewFileName)
+}
+
+func TestVarWarnings(t *testing.T) {
+	p, err := ParseProp("aired=\\d+\\.\\d+\\.\\d+")
+	assert.Nil(t, err)
+	date, err := ParseVar("date=$aired[@%d.%m.%Y>%Y-%m-%d]")
+	assert.Nil(t, err)
+	out, err := ParseOutput("Show $date$ext")
+	assert.Nil(t, err)
+
+	rlog, err := RenameAllFiles([]Prop{p}, []Var{date}, out, []string{"Show 40.13.2020.mkv"}, Opts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Show 40.13.2020.mkv", rlog[0].NewFileName)
+	assert.Equal(t, 1, len(rlog[0].Warnings))
+	assert.Equal(t, RenameWarningTypeInvalidDate, rlog[0].Warnings[0].Type)
+}